@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	cloudsession "github.com/jaylees14/pow/client/cloud-session"
+	"github.com/jaylees14/pow/client/cmd"
+	"github.com/jaylees14/pow/worker/chain"
+	"github.com/jaylees14/pow/worker/nonce"
+)
+
+// runChain mines blocks onto the chain file one after another, locally or on a single cloud session, saving the
+// chain after each block so a long run can be stopped and extended later
+func runChain(config *cmd.WorkerConfig) {
+	if config.Simulate {
+		simulateChain(config)
+		return
+	}
+
+	c, err := openChain(config)
+	checkError(err, "Couldn't open chain", nil)
+
+	config.LogConfig()
+	log.Printf("Mining %d block(s) onto %s, which has %d", config.Blocks, config.ChainFile, len(c.Blocks))
+
+	var cloudSession *cloudsession.CloudSession
+	if !config.Local {
+		cloudSession = newCloudSession(config)
+	}
+
+	for i := 0; i < config.Blocks; i++ {
+		start := time.Now()
+		b, err := c.Next(*config.Block, config.Target, start)
+		checkError(err, "Couldn't create block", cloudSession)
+		if tip := c.Tip(); tip != nil && b.Target != tip.Target {
+			log.Printf("Retargeted from %s to %s", tip.Target, b.Target)
+		}
+		if len(config.Transactions) > 0 {
+			// Split the transactions evenly between the blocks, in order
+			n := len(config.Transactions)
+			err = b.Commit(config.Transactions[i*n/config.Blocks : (i+1)*n/config.Blocks])
+			checkError(err, "Couldn't commit to transactions", cloudSession)
+		}
+
+		if config.Local {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Timeout)*time.Second)
+			err = c.Mine(ctx, b)
+			cancel()
+		} else {
+			err = mineBlockInCloud(config, cloudSession, c, b)
+		}
+		checkError(err, "Couldn't mine block", cloudSession)
+
+		err = c.Save(config.ChainFile)
+		checkError(err, "Couldn't save chain", cloudSession)
+		log.Printf("Block %d: nonce %d (extra nonce %d) with hash %s, in %s", b.Index, b.Nonce, b.ExtraNonce, b.Hash, time.Since(start).Round(time.Millisecond))
+	}
+
+	if cloudSession != nil {
+		cloudSession.Cleanup()
+	}
+}
+
+// openChain loads the chain file to extend, or starts a new chain if there isn't one
+func openChain(config *cmd.WorkerConfig) (*chain.Chain, error) {
+	c, err := chain.Load(config.ChainFile)
+	if os.IsNotExist(err) {
+		c, err = chain.New(config.Algo, config.AlgoParams)
+		if err != nil {
+			return nil, err
+		}
+		c.Retarget = config.Retarget
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	} else if c.Algo != config.Algo || c.AlgoParams != config.AlgoParams {
+		return nil, fmt.Errorf("Invalid algorithm, the chain is mined with %s", strings.TrimSpace(c.Algo+" "+c.AlgoParams))
+	} else if config.Retarget != nil && (c.Retarget == nil || *c.Retarget != *config.Retarget) {
+		return nil, errors.New("Invalid retarget, an existing chain keeps the retargeting it was created with")
+	}
+	return c, nil
+}
+
+// simulateChain mines blocks statistically with a changing number of workers, reporting how long each took and
+// the average block time between each change
+func simulateChain(config *cmd.WorkerConfig) {
+	scale := config.Scale
+	workers := config.Workers
+	sim := &chain.Simulation{
+		Retarget: config.Retarget,
+		Initial:  config.Target,
+		HashRate: config.HashRate,
+		Workers: func(height int) int {
+			if len(scale) > 0 && height >= scale[0].Height {
+				workers = scale[0].Workers
+				scale = scale[1:]
+			}
+			return workers
+		},
+		Rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	log.Printf("Simulating %d block(s) at %.3g hashes per second per worker", config.Blocks, config.HashRate)
+	var total time.Duration
+	count := 0
+	blocks := sim.Run(config.Blocks)
+	for i, b := range blocks {
+		fmt.Printf("Block %d: %d workers, %.3g expected hashes, took %s\n", b.Index, b.Workers, 1/b.Target.Probability(), b.SolveTime.Round(time.Millisecond))
+		total += b.SolveTime
+		count++
+		if i == len(blocks)-1 || blocks[i+1].Workers != b.Workers {
+			fmt.Printf("Average block time with %d workers: %s over %d blocks\n", b.Workers, (total / time.Duration(count)).Round(time.Millisecond), count)
+			total, count = 0, 0
+		}
+	}
+}
+
+// mineBlockInCloud searches for the nonce of b, the chain's next block, across the cloud session's workers, and
+// appends it to the chain. Each block is a new search, so responses about earlier blocks are ignored.
+func mineBlockInCloud(config *cmd.WorkerConfig, cloudSession *cloudsession.CloudSession, c *chain.Chain, b *chain.Block) error {
+	contents := b.Contents()
+	search := *config
+	search.Block = &contents
+	search.Target = b.Target
+
+	partitioner := newWorkPartitioner(&search, cloudSession)
+	if err := partitioner.partitionWork(); err != nil {
+		return err
+	}
+
+	response, err := cloudSession.WaitForResponse(partitioner.searchID, config.Timeout, func(*cloudsession.WorkerResponse) (bool, error) {
+		return partitioner.sendNext()
+	})
+	// The other workers are still mining this block, and would hold up the next one
+	partitioner.cancel()
+	if err != nil {
+		return err
+	}
+
+	n, err := strconv.ParseUint(*response.Nonce, 10, 32)
+	if err != nil {
+		return err
+	}
+	extraNonce, err := strconv.ParseUint(*response.ExtraNonce, 10, 32)
+	if err != nil {
+		return err
+	}
+	b.Solved(&nonce.GoldenNonce{Nonce: uint32(n), ExtraNonce: uint32(extraNonce)}, c.Hasher())
+	return c.Append(b)
+}
@@ -12,16 +12,29 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/jaylees14/pow/worker/nonce"
 )
 
 const (
 	InputQueue  string = "INPUT_QUEUE"
 	OutputQueue string = "OUTPUT_QUEUE"
+	// CancelQueue holds the IDs of searches which are over, which every worker reads without removing
+	CancelQueue string = "CANCEL_QUEUE"
 
 	DockerAMI string = "ami-081ff81791becd5df"
 	ECRAMI    string = "ami-097e3d1cdb541f43e"
 )
 
+// enumerationGracePeriod is how many seconds beyond the timeout to wait for enumerating workers to report
+const enumerationGracePeriod int = 60
+
+// Seconds messages are kept for. Workers poll for cancellations every few seconds and remember them, so the
+// cancel queue only keeps them for the shortest time SQS allows.
+const (
+	queueRetention       int = 86400
+	cancelQueueRetention int = 60
+)
+
 var iamRoles []string = []string{
 	"arn:aws:iam::aws:policy/AmazonSQSFullAccess",
 	"arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryReadOnly",
@@ -34,17 +47,52 @@ type CloudSession struct {
 	session               *session.Session
 	inputQueueURL         *string
 	outputQueueURL        *string
+	cancelQueueURL        *string
 	ec2WorkerInstanceIds  []*ec2.Instance
 	ec2MonitorInstanceIds []*ec2.Instance
 	advisorService        *ecs.Service
 	grafanaService        *ecs.Service
 }
 
-// WorkerResponse represents a worker's response to a task, which may or not be successful
+// Job describes the partition of the search sent to a single worker
+type Job struct {
+	// SearchID is echoed back in responses, distinguishing them from those to earlier searches on the same session
+	SearchID   string
+	Block      *string
+	LowerBound uint32
+	// UpperBound is exclusive, and is nonce.NonceSpace for the partition holding the last nonce
+	UpperBound uint64
+	ExtraNonce uint32
+	Target     nonce.Target
+	// Pattern, if set, is sent instead of Target
+	Pattern    *nonce.Pattern
+	Timeout    int
+	Algo       string
+	AlgoParams string
+	Header     *nonce.BlockHeader
+	Encoding   nonce.Encoding
+	// Order is the order the worker searches the partition in, which is only its share of the range if the order
+	// interleaves the workers
+	Order nonce.Order
+	// Enumerate scans the whole partition, reporting every golden nonce, or the TopK lowest hashes if non-zero
+	Enumerate bool
+	TopK      int
+}
+
+// WorkerResponse represents a worker's response to a task, which may or not be successful.
+// On failure Nonce, ExtraNonce and Hash describe the best hash found, if the worker found one.
 type WorkerResponse struct {
-	Success bool
-	Nonce   *string
-	Hash    *string
+	Success      bool
+	Nonce        *string
+	ExtraNonce   *string
+	Hash         *string
+	LeadingZeros *string
+	// Hashes is how many the worker computed, only reported on failure
+	Hashes   *string
+	SearchID *string
+	// Only set when enumerating, where each worker streams its nonces over several responses ending with Final
+	Enumeration *nonce.Enumeration
+	Final       bool
 }
 
 // NewDocker constructs a CloudSession based on a Docker-Compose insfrastructure
@@ -88,7 +136,7 @@ func NewDocker(instances int64, workerCloudConfig []byte, monitorCloudConfig []b
 	}
 
 	// Create an input queue
-	inputQueue, err := createQueue(session, InputQueue)
+	inputQueue, err := createQueue(session, InputQueue, queueRetention)
 	if err != nil {
 		return nil, err
 	}
@@ -99,7 +147,7 @@ func NewDocker(instances int64, workerCloudConfig []byte, monitorCloudConfig []b
 	}
 
 	// Create an output queue
-	outputQueue, err := createQueue(session, OutputQueue)
+	outputQueue, err := createQueue(session, OutputQueue, queueRetention)
 	if err != nil {
 		return nil, err
 	}
@@ -108,6 +156,16 @@ func NewDocker(instances int64, workerCloudConfig []byte, monitorCloudConfig []b
 		return nil, err
 	}
 
+	// Create a cancel queue
+	cancelQueue, err := createQueue(session, CancelQueue, cancelQueueRetention)
+	if err != nil {
+		return nil, err
+	}
+	_, err = clearQueue(session, cancelQueue.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
 	go func() {
 		time.Sleep(30 * time.Second)
 		ip, err := getEC2InstanceIP(session, *ec2MonitorInstances.Instances[0].InstanceId)
@@ -120,6 +178,7 @@ func NewDocker(instances int64, workerCloudConfig []byte, monitorCloudConfig []b
 		session:               session,
 		inputQueueURL:         inputQueue.QueueUrl,
 		outputQueueURL:        outputQueue.QueueUrl,
+		cancelQueueURL:        cancelQueue.QueueUrl,
 		ec2WorkerInstanceIds:  ec2WorkerInstances.Instances,
 		ec2MonitorInstanceIds: ec2MonitorInstances.Instances,
 	}, nil
@@ -233,7 +292,7 @@ func NewECS(instances int64, workerCloudConfig []byte, monitorCloudConfig []byte
 	}
 
 	// Create an input queue
-	inputQueue, err := createQueue(session, InputQueue)
+	inputQueue, err := createQueue(session, InputQueue, queueRetention)
 	if err != nil {
 		return nil, err
 	}
@@ -245,7 +304,7 @@ func NewECS(instances int64, workerCloudConfig []byte, monitorCloudConfig []byte
 	}
 
 	// Create an output queue
-	outputQueue, err := createQueue(session, OutputQueue)
+	outputQueue, err := createQueue(session, OutputQueue, queueRetention)
 	if err != nil {
 		return nil, err
 	}
@@ -256,6 +315,18 @@ func NewECS(instances int64, workerCloudConfig []byte, monitorCloudConfig []byte
 		return nil, err
 	}
 
+	// Create a cancel queue
+	cancelQueue, err := createQueue(session, CancelQueue, cancelQueueRetention)
+	if err != nil {
+		return nil, err
+	}
+
+	// Clear cancel queue
+	_, err = clearQueue(session, cancelQueue.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create EC2 instances for the worker cluster
 	ec2WorkerInstances, err := createEC2Instances(session, ECRAMI, instances, workerCloudConfig, workerSecurityGroup, iamRole.Arn)
 	if err != nil {
@@ -315,6 +386,7 @@ func NewECS(instances int64, workerCloudConfig []byte, monitorCloudConfig []byte
 		session:               session,
 		inputQueueURL:         inputQueue.QueueUrl,
 		outputQueueURL:        outputQueue.QueueUrl,
+		cancelQueueURL:        cancelQueue.QueueUrl,
 		ec2WorkerInstanceIds:  ec2WorkerInstances.Instances,
 		ec2MonitorInstanceIds: ec2MonitorInstances.Instances,
 		advisorService:        advisorService.Service,
@@ -323,7 +395,7 @@ func NewECS(instances int64, workerCloudConfig []byte, monitorCloudConfig []byte
 }
 
 // SendMessageOnQueue sends a message on a queue
-func (cs *CloudSession) SendMessageOnQueue(queueType string, message *string, lower uint32, upper uint32, target int) error {
+func (cs *CloudSession) SendMessageOnQueue(queueType string, job *Job) error {
 	qURL := ""
 	if queueType == OutputQueue {
 		qURL = *cs.outputQueueURL
@@ -333,38 +405,102 @@ func (cs *CloudSession) SendMessageOnQueue(queueType string, message *string, lo
 		return errors.New("Invalid queue type, must be InputQueue or OutputQueue")
 	}
 
+	attributes := map[string]*sqs.MessageAttributeValue{
+		"Message": &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: job.Block,
+		},
+		// Both bounds share an attribute, leaving room for the optional ones within SQS's limit of 10
+		"Range": &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(fmt.Sprintf("%d:%d", job.LowerBound, job.UpperBound)),
+		},
+		"ExtraNonce": &sqs.MessageAttributeValue{
+			DataType:    aws.String("Number"),
+			StringValue: aws.String(strconv.FormatUint(uint64(job.ExtraNonce), 10)),
+		},
+		"Timeout": &sqs.MessageAttributeValue{
+			DataType:    aws.String("Number"),
+			StringValue: aws.String(strconv.FormatInt(int64(job.Timeout), 10)),
+		},
+		"Algo": &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(job.Algo),
+		},
+	}
+	// Exactly one of these is sent, keeping within SQS's limit of 10 attributes
+	if job.Pattern != nil {
+		attributes["Pattern"] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(job.Pattern.String()),
+		}
+	} else {
+		attributes["Target"] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(job.Target.String()),
+		}
+	}
+	// SQS rejects empty attribute values, and only memory-hard algorithms have parameters
+	if len(job.AlgoParams) > 0 {
+		attributes["AlgoParams"] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(job.AlgoParams),
+		}
+	}
+	if job.Header != nil {
+		attributes["Header"] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(job.Header.String()),
+		}
+	}
+	// SQS allows at most 10 attributes, which header mode's fixed encoding keeps this within
+	if job.Header == nil && job.Encoding != nonce.DefaultEncoding {
+		attributes["Encoding"] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(job.Encoding.String()),
+		}
+	}
+	// Only sent when the partition isn't searched in sequence
+	if len(job.Order.Kind) > 0 && job.Order.Kind != nonce.Sequential {
+		attributes["Order"] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(job.Order.String()),
+		}
+	}
+	if job.Enumerate {
+		attributes["Enumerate"] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("Number"),
+			StringValue: aws.String(strconv.Itoa(job.TopK)),
+		}
+	}
+
 	// TODO: Move this to a util
+	svc := sqs.New(cs.session)
+	_, err := svc.SendMessage(&sqs.SendMessageInput{
+		DelaySeconds:      aws.Int64(0),
+		MessageAttributes: attributes,
+		MessageBody:       aws.String(job.SearchID),
+		QueueUrl:          &qURL,
+	})
+	return err
+}
+
+// CancelSearch tells the workers that searchID is over, so they stop its running jobs and drop any still queued
+func (cs *CloudSession) CancelSearch(searchID string) error {
 	svc := sqs.New(cs.session)
 	_, err := svc.SendMessage(&sqs.SendMessageInput{
 		DelaySeconds: aws.Int64(0),
-		MessageAttributes: map[string]*sqs.MessageAttributeValue{
-			"Message": &sqs.MessageAttributeValue{
-				DataType:    aws.String("String"),
-				StringValue: message,
-			},
-			"LowerBound": &sqs.MessageAttributeValue{
-				DataType:    aws.String("Number"),
-				StringValue: aws.String(strconv.FormatUint(uint64(lower), 10)),
-			},
-			"UpperBound": &sqs.MessageAttributeValue{
-				DataType:    aws.String("Number"),
-				StringValue: aws.String(strconv.FormatUint(uint64(upper), 10)),
-			},
-			"Target": &sqs.MessageAttributeValue{
-				DataType:    aws.String("Number"),
-				StringValue: aws.String(strconv.FormatInt(int64(target), 10)),
-			},
-		},
-		MessageBody: aws.String("FIXME"),
-		QueueUrl:    &qURL,
+		MessageBody:  aws.String(searchID),
+		QueueUrl:     cs.cancelQueueURL,
 	})
 	return err
 }
 
-// WaitForResponse waits for a response from the send requests
-func (cs *CloudSession) WaitForResponse(timeout int) (*WorkerResponse, error) {
+// WaitForResponse waits for a response to the jobs sent for searchID, discarding any left over from earlier searches.
+// onFailure is called with each worker's failure to find a nonce, and reports whether it sent that worker another job.
+func (cs *CloudSession) WaitForResponse(searchID string, timeout int, onFailure func(*WorkerResponse) (bool, error)) (*WorkerResponse, error) {
 	timeWaited := 0
-	responsesReceived := 0
+	jobsOutstanding := len(cs.ec2WorkerInstanceIds)
 
 	for timeWaited < timeout {
 		result, err := getMessageFromQueue(cs.session, cs.outputQueueURL)
@@ -375,20 +511,29 @@ func (cs *CloudSession) WaitForResponse(timeout int) (*WorkerResponse, error) {
 		if len(result.Messages) > 0 {
 			// Try and decode
 			for _, message := range result.Messages {
-				decoded, err := decodeWorkerMessage(message)
+				decoded, err := cs.receiveWorkerMessage(message, searchID)
 				if err != nil {
 					return nil, err
+				} else if decoded == nil {
+					continue
 				}
-				responsesReceived++
+				jobsOutstanding--
 
 				if decoded.Success {
 					return decoded, nil
 				}
+
+				resent, err := onFailure(decoded)
+				if err != nil {
+					return nil, err
+				} else if resent {
+					jobsOutstanding++
+				}
 			}
 		}
 
-		// If received a failure from every worker
-		if responsesReceived == len(cs.ec2WorkerInstanceIds) {
+		// If received a failure from every job
+		if jobsOutstanding == 0 {
 			return nil, fmt.Errorf("No golden nonce found")
 		}
 
@@ -398,6 +543,64 @@ func (cs *CloudSession) WaitForResponse(timeout int) (*WorkerResponse, error) {
 	return nil, fmt.Errorf("No result found after %d seconds", timeWaited)
 }
 
+// WaitForEnumeration collects the nonces streamed back by every worker enumerating its partition, calling onResults
+// for each response. Workers stop at their own timeout before reporting, so a grace period is allowed on top of it.
+func (cs *CloudSession) WaitForEnumeration(searchID string, timeout int, onResults func(*WorkerResponse)) error {
+	timeWaited := 0
+	jobsOutstanding := len(cs.ec2WorkerInstanceIds)
+
+	for timeWaited < timeout+enumerationGracePeriod {
+		result, err := getMessageFromQueue(cs.session, cs.outputQueueURL)
+		if err != nil {
+			return err
+		}
+
+		for _, message := range result.Messages {
+			decoded, err := cs.receiveWorkerMessage(message, searchID)
+			if err != nil {
+				return err
+			} else if decoded == nil {
+				continue
+			}
+
+			// A failed worker sends nothing more
+			if !decoded.Success || decoded.Final {
+				jobsOutstanding--
+			}
+			if decoded.Enumeration != nil {
+				onResults(decoded)
+			}
+		}
+
+		if jobsOutstanding == 0 {
+			return nil
+		}
+
+		timeWaited += 10
+	}
+
+	return fmt.Errorf("%d workers didn't finish enumerating after %d seconds", jobsOutstanding, timeWaited)
+}
+
+// receiveWorkerMessage decodes a response and deletes it from the output queue, so it isn't received again.
+// Responses to searches other than searchID are dropped, returning nil.
+func (cs *CloudSession) receiveWorkerMessage(message *sqs.Message, searchID string) (*WorkerResponse, error) {
+	decoded, err := decodeWorkerMessage(message)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = deleteMessage(cs.session, cs.outputQueueURL, message)
+	if err != nil {
+		return nil, err
+	}
+
+	if decoded.SearchID == nil || *decoded.SearchID != searchID {
+		return nil, nil
+	}
+	return decoded, nil
+}
+
 // Cleanup tears down all infrastructure put in place to perform the computation
 func (cs *CloudSession) Cleanup() {
 	// Remove EC2 instances
@@ -423,6 +626,12 @@ func (cs *CloudSession) Cleanup() {
 		log.Print(err)
 	}
 
+	// Clear cancel queue
+	_, err = clearQueue(cs.session, cs.cancelQueueURL)
+	if err != nil {
+		log.Print(err)
+	}
+
 	if cs.advisorService != nil {
 		_, err = stopECSService(cs.session, cs.advisorService.ClusterArn, cs.advisorService.ServiceName)
 		if err != nil {
@@ -1,21 +1,23 @@
 package cloudsession
 
 import (
+	"encoding/json"
 	"errors"
 	"strconv"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/jaylees14/pow/worker/nonce"
 )
 
 // -- SQS
-func createQueue(session *session.Session, queueName string) (*sqs.CreateQueueOutput, error) {
+func createQueue(session *session.Session, queueName string, retentionSeconds int) (*sqs.CreateQueueOutput, error) {
 	svc := sqs.New(session)
 	return svc.CreateQueue(&sqs.CreateQueueInput{
 		QueueName: aws.String(queueName),
 		Attributes: map[string]*string{
-			"MessageRetentionPeriod": aws.String("86400"),
+			"MessageRetentionPeriod": aws.String(strconv.Itoa(retentionSeconds)),
 		},
 	})
 }
@@ -36,6 +38,14 @@ func getMessageFromQueue(session *session.Session, queueURL *string) (*sqs.Recei
 	})
 }
 
+func deleteMessage(session *session.Session, queueURL *string, message *sqs.Message) (*sqs.DeleteMessageOutput, error) {
+	svc := sqs.New(session)
+	return svc.DeleteMessage(&sqs.DeleteMessageInput{
+		ReceiptHandle: message.ReceiptHandle,
+		QueueUrl:      queueURL,
+	})
+}
+
 func decodeWorkerMessage(message *sqs.Message) (*WorkerResponse, error) {
 	successStr, ok := message.MessageAttributes["Success"]
 	if !ok {
@@ -47,26 +57,82 @@ func decodeWorkerMessage(message *sqs.Message) (*WorkerResponse, error) {
 		return nil, err
 	}
 
+	// Failures may carry the best hash the worker found instead
 	if !success {
 		return &WorkerResponse{
-			Success: success,
+			Success:      success,
+			Nonce:        optionalAttribute(message, "Nonce"),
+			ExtraNonce:   optionalAttribute(message, "ExtraNonce"),
+			Hash:         optionalAttribute(message, "Hash"),
+			LeadingZeros: optionalAttribute(message, "LeadingZeros"),
+			Hashes:       optionalAttribute(message, "Hashes"),
+			SearchID:     optionalAttribute(message, "SearchID"),
 		}, nil
 	}
 
+	// Enumerating workers send their nonces in the body instead
+	if finalStr, ok := message.MessageAttributes["Final"]; ok {
+		return decodeEnumerationMessage(message, finalStr)
+	}
+
 	nonceStr, ok := message.MessageAttributes["Nonce"]
 	if !ok {
 		return nil, errors.New("Message didn't contain key Nonce")
 	}
 
+	extraNonceStr, ok := message.MessageAttributes["ExtraNonce"]
+	if !ok {
+		return nil, errors.New("Message didn't contain key ExtraNonce")
+	}
+
 	hashStr, ok := message.MessageAttributes["Hash"]
 	if !ok {
 		return nil, errors.New("Message didn't contain key Hash")
 	}
 
 	return &WorkerResponse{
-		Success: success,
-		Hash:    hashStr.StringValue,
-		Nonce:   nonceStr.StringValue,
+		Success:    success,
+		Hash:       hashStr.StringValue,
+		Nonce:      nonceStr.StringValue,
+		ExtraNonce: extraNonceStr.StringValue,
+		SearchID:   optionalAttribute(message, "SearchID"),
+	}, nil
+}
+
+// optionalAttribute returns the value of the message attribute key, or nil if it wasn't sent
+func optionalAttribute(message *sqs.Message, key string) *string {
+	if value, ok := message.MessageAttributes[key]; ok {
+		return value.StringValue
+	}
+	return nil
+}
+
+func decodeEnumerationMessage(message *sqs.Message, finalStr *sqs.MessageAttributeValue) (*WorkerResponse, error) {
+	final, err := strconv.ParseBool(*finalStr.StringValue)
+	if err != nil {
+		return nil, err
+	}
+
+	hashesStr, ok := message.MessageAttributes["Hashes"]
+	if !ok {
+		return nil, errors.New("Message didn't contain key Hashes")
+	}
+
+	hashes, err := strconv.ParseUint(*hashesStr.StringValue, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	enumeration := &nonce.Enumeration{Hashes: hashes}
+	if err := json.Unmarshal([]byte(*message.Body), &enumeration.Nonces); err != nil {
+		return nil, err
+	}
+
+	return &WorkerResponse{
+		Success:     true,
+		Enumeration: enumeration,
+		Final:       final,
+		SearchID:    optionalAttribute(message, "SearchID"),
 	}, nil
 }
 
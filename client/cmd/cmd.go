@@ -7,20 +7,87 @@ import (
 	"log"
 	"math"
 	"os"
+	"strings"
+	"time"
+
+	"github.com/jaylees14/pow/worker/chain"
+	"github.com/jaylees14/pow/worker/hashcash"
+	"github.com/jaylees14/pow/worker/nonce"
 )
 
+// Subcommands selecting what the client does
 const (
-	noncesProcessedPerSecond uint32 = 470000
+	DirectMode   string = "direct"
+	IndirectMode string = "indirect"
+	VerifyMode   string = "verify"
+	HashcashMode string = "hashcash"
+	ChainMode    string = "chain"
+	MerkleMode   string = "merkle"
+	ValidateMode string = "validate"
 )
 
+// calibrationTime is how long this machine hashes for to estimate a worker's hash rate, when none is given
+const calibrationTime = 500 * time.Millisecond
+
 // WorkerConfig built from Command Line
 type WorkerConfig struct {
+	Mode         string
 	Block        *string
 	LeadingZeros int
-	Workers      int
-	Timeout      int
-	Confidence   int
-	UseECS       bool
+	Target       nonce.Target
+	// Pattern, if set, replaces Target when searching for vanity hashes
+	Pattern    *nonce.Pattern
+	Workers    int
+	Timeout    int
+	Confidence int
+	Algo       string
+	AlgoParams string
+	Header     *nonce.BlockHeader
+	Encoding   nonce.Encoding
+	// Order is the order each worker searches its partition in, where a Strided order interleaves the workers too
+	Order  nonce.Order
+	UseECS bool
+	// Enumerate scans the whole nonce space, reporting every golden nonce, or the TopK lowest hashes if non-zero
+	Enumerate bool
+	TopK      int
+	// Only used in verify mode
+	Nonce        uint32
+	ExtraNonce   uint32
+	ExpectedHash string
+	// Local mines on this machine rather than in the cloud, in hashcash and chain modes
+	Local bool
+	// Only used in hashcash mode, where LeadingZeros is the stamp's bits
+	Resource  string
+	Ext       string
+	Count     int
+	Stamp     string
+	SeenStore string
+	MaxAge    time.Duration
+	// Only used in chain mode, where Block is each block's payload and Timeout is per block, and ChainFile is also
+	// checked in validate mode
+	Blocks    int
+	ChainFile string
+	// BlockFile is a single block checked in validate mode instead of ChainFile
+	BlockFile string
+	// Retarget, if set, adjusts the target of every block after the first of a new chain
+	Retarget *chain.Retarget
+	// Simulate mines the chain statistically rather than by hashing, with HashRate hashes per second per worker,
+	// and the number of workers changing at the heights in Scale
+	Simulate bool
+	HashRate float64
+	Scale    []ScaleStep
+	// Transactions are split between the blocks in place of the payload in chain mode, or proved in merkle mode
+	Transactions []string
+	// Only used in merkle mode, which proves the transaction at ProofIndex, or checks the proof in ProofFile
+	ProofIndex int
+	ProofFile  string
+	Root       string
+}
+
+// ScaleStep changes the number of simulated workers from the block at Height on
+type ScaleStep struct {
+	Height  int
+	Workers int
 }
 
 // LogConfig will output the configuration being used
@@ -31,9 +98,29 @@ func (wc *WorkerConfig) LogConfig() {
 	}
 
 	log.Printf("--- Configuration ---")
-	log.Printf("Block: %s", *wc.Block)
+	if wc.Header != nil {
+		log.Printf("Block header: %s", wc.Header.String())
+	} else {
+		log.Printf("Block: %s", *wc.Block)
+		log.Printf("Nonce encoding: %s", wc.Encoding)
+	}
 	log.Printf("Timeout: %d seconds", wc.Timeout)
-	log.Printf("Leading zeros: %d", wc.LeadingZeros)
+	if wc.Header != nil {
+		log.Printf("Target: %s (bits %08x)", wc.Header.Target(), wc.Header.Bits)
+	} else if wc.Pattern != nil {
+		log.Printf("Pattern: %s (probability %.3g)", wc.Pattern, wc.Pattern.Probability())
+	} else {
+		log.Printf("Target: %s (%d leading zeros)", wc.Target, wc.Target.LeadingZeros())
+	}
+	log.Printf("Algorithm: %s %s", wc.Algo, wc.AlgoParams)
+	if len(wc.Order.Kind) > 0 && wc.Order.Kind != nonce.Sequential {
+		log.Printf("Search order: %s", wc.Order)
+	}
+	if wc.Enumerate && wc.TopK > 0 {
+		log.Printf("Enumerating: %d lowest hashes", wc.TopK)
+	} else if wc.Enumerate {
+		log.Printf("Enumerating: every golden nonce")
+	}
 	log.Printf("Workers: %d", wc.Workers)
 	log.Printf("Deployment strategy: %s", strategy)
 	log.Printf("---------------------")
@@ -41,39 +128,143 @@ func (wc *WorkerConfig) LogConfig() {
 
 // ParseArgs will parse the command line arguments and produce a configuration
 func ParseArgs() (*WorkerConfig, error) {
-	// Two modes
-	directCommand := flag.NewFlagSet("direct", flag.ExitOnError)
-	indirectCommand := flag.NewFlagSet("indirect", flag.ExitOnError)
+	// Seven modes
+	directCommand := flag.NewFlagSet(DirectMode, flag.ExitOnError)
+	indirectCommand := flag.NewFlagSet(IndirectMode, flag.ExitOnError)
+	verifyCommand := flag.NewFlagSet(VerifyMode, flag.ExitOnError)
+	hashcashCommand := flag.NewFlagSet(HashcashMode, flag.ExitOnError)
+	chainCommand := flag.NewFlagSet(ChainMode, flag.ExitOnError)
+	merkleCommand := flag.NewFlagSet(MerkleMode, flag.ExitOnError)
+	validateCommand := flag.NewFlagSet(ValidateMode, flag.ExitOnError)
 
 	// Direct mode args
-	directBlock := directCommand.String("block", "COMSM0010cloud", "block of data the nonce is appended to")
+	directBlock := directCommand.String("block", "COMSM0010cloud", "block of data the nonce is appended to, or placed in at {nonce}")
 	directLeadingZeros := directCommand.Int("d", 20, "number of leading zeros")
+	directTarget := directCommand.String("target", "", "256-bit target as 64 hex digits, or compact nBits as 8 hex digits, instead of -d")
+	directPattern := directCommand.String("pattern", "", "hex digest pattern instead of a target: prefix:<hex>, suffix:<hex>, mask:<hex>/<hex> or regex:<expression>")
 	directTimeout := directCommand.Int("timeout", 360, "timeout in seconds")
 	directWorkers := directCommand.Int("n", 1, "number of workers")
 	directECS := directCommand.Bool("use-ecs", false, "use ecs as a task scheduler")
+	directAlgo := directCommand.String("algo", nonce.SHA256D, "hashing algorithm: sha256d, sha256, sha3-256, blake2b-256, scrypt or argon2id")
+	directAlgoParams := directCommand.String("algo-params", "", "cost parameters for memory-hard algorithms, e.g. N=1024,r=1,p=1 or time=1,memory=4096,threads=1")
+	directEncoding := directCommand.String("encoding", nonce.DefaultEncoding.String(), "nonce encoding: be, le, dec or hex, with an optional width such as be:8 or dec:10")
+	directHeader := addHeaderArgs(directCommand)
+	directAll := directCommand.Bool("all", false, "scan the whole nonce space and report every golden nonce")
+	directTopK := directCommand.Int("top-k", 0, "scan the whole nonce space and report the k lowest hashes")
+	directOrder := directCommand.String("order", nonce.Sequential, "order the nonce space is searched in: sequential, strided across workers and threads, shuffled or random-offsets, with optional lanes such as strided:8")
+	directSeed := directCommand.Uint64("seed", 0, "seed of the shuffled and random-offsets orders (default random)")
 
 	// Indirect mode args
-	indirectBlock := indirectCommand.String("block", "COMSM0010cloud", "block of data the nonce is appended to")
+	indirectBlock := indirectCommand.String("block", "COMSM0010cloud", "block of data the nonce is appended to, or placed in at {nonce}")
 	indirectLeadingZeros := indirectCommand.Int("d", 20, "number of leading zeros")
+	indirectTarget := indirectCommand.String("target", "", "256-bit target as 64 hex digits, or compact nBits as 8 hex digits, instead of -d")
+	indirectPattern := indirectCommand.String("pattern", "", "hex digest pattern instead of a target: prefix:<hex>, suffix:<hex>, mask:<hex>/<hex> or regex:<expression>")
 	indirectTimeout := indirectCommand.Int("timeout", 360, "timeout in seconds")
 	indirectConfidence := indirectCommand.Int("confidence", 95, "confidence in finding the result, as a percentage")
 	indirectECS := indirectCommand.Bool("use-ecs", false, "use ecs as a task scheduler")
+	indirectAlgo := indirectCommand.String("algo", nonce.SHA256D, "hashing algorithm: sha256d, sha256, sha3-256, blake2b-256, scrypt or argon2id")
+	indirectAlgoParams := indirectCommand.String("algo-params", "", "cost parameters for memory-hard algorithms, e.g. N=1024,r=1,p=1 or time=1,memory=4096,threads=1")
+	indirectEncoding := indirectCommand.String("encoding", nonce.DefaultEncoding.String(), "nonce encoding: be, le, dec or hex, with an optional width such as be:8 or dec:10")
+	indirectHeader := addHeaderArgs(indirectCommand)
+	indirectAll := indirectCommand.Bool("all", false, "scan the whole nonce space and report every golden nonce")
+	indirectTopK := indirectCommand.Int("top-k", 0, "scan the whole nonce space and report the k lowest hashes")
+	indirectOrder := indirectCommand.String("order", nonce.Sequential, "order the nonce space is searched in: sequential, strided across workers and threads, shuffled or random-offsets, with optional lanes such as strided:8")
+	indirectSeed := indirectCommand.Uint64("seed", 0, "seed of the shuffled and random-offsets orders (default random)")
+	indirectHashRate := indirectCommand.Float64("hash-rate", 0, "hashes per second of each worker, used to choose the number of workers (default measured on this machine)")
+
+	// Verify mode args
+	verifyBlock := verifyCommand.String("block", "COMSM0010cloud", "block of data the nonce is appended to, or placed in at {nonce}")
+	verifyLeadingZeros := verifyCommand.Int("d", 20, "number of leading zeros")
+	verifyTarget := verifyCommand.String("target", "", "256-bit target as 64 hex digits, or compact nBits as 8 hex digits, instead of -d")
+	verifyPattern := verifyCommand.String("pattern", "", "hex digest pattern instead of a target: prefix:<hex>, suffix:<hex>, mask:<hex>/<hex> or regex:<expression>")
+	verifyNonce := verifyCommand.Uint("nonce", 0, "golden nonce to verify")
+	verifyExtraNonce := verifyCommand.Uint("extra-nonce", 0, "extra nonce the golden nonce was found with")
+	verifyHash := verifyCommand.String("hash", "", "expected hash, checked against the recomputed one if given")
+	verifyAlgo := verifyCommand.String("algo", nonce.SHA256D, "hashing algorithm: sha256d, sha256, sha3-256, blake2b-256, scrypt or argon2id")
+	verifyAlgoParams := verifyCommand.String("algo-params", "", "cost parameters for memory-hard algorithms, e.g. N=1024,r=1,p=1 or time=1,memory=4096,threads=1")
+	verifyEncoding := verifyCommand.String("encoding", nonce.DefaultEncoding.String(), "nonce encoding: be, le, dec or hex, with an optional width such as be:8 or dec:10")
+	verifyHeader := addHeaderArgs(verifyCommand)
+
+	// Hashcash mode args
+	hashcashResource := hashcashCommand.String("resource", "", "resource the stamp is for, such as an email address")
+	hashcashBits := hashcashCommand.Int("bits", 20, "number of leading zero bits the stamp must have, at most 40 when minting")
+	hashcashExt := hashcashCommand.String("ext", "", "extension field of the stamp")
+	hashcashCount := hashcashCommand.Int("count", 1, "number of stamps to mint")
+	hashcashLocal := hashcashCommand.Bool("local", false, "mint stamps on this machine rather than in the cloud")
+	hashcashTimeout := hashcashCommand.Int("timeout", 360, "timeout in seconds for each stamp")
+	hashcashWorkers := hashcashCommand.Int("n", 1, "number of workers")
+	hashcashECS := hashcashCommand.Bool("use-ecs", false, "use ecs as a task scheduler")
+	hashcashVerify := hashcashCommand.String("verify", "", "stamp to verify for -resource instead of minting")
+	hashcashSeenStore := hashcashCommand.String("seen-store", "", "file of spent stamps, checked for double spending when verifying")
+	hashcashMaxAge := hashcashCommand.Duration("max-age", hashcash.DefaultMaxAge, "how old a stamp may be when verifying")
+
+	// Chain mode args
+	chainBlock := chainCommand.String("block", "COMSM0010cloud", "payload of each block")
+	chainBlocks := chainCommand.Int("blocks", 10, "number of blocks to mine")
+	chainOut := chainCommand.String("out", "chain.json", "chain file the blocks are added to, created if it doesn't exist")
+	chainLeadingZeros := chainCommand.Int("d", 20, "number of leading zeros")
+	chainTarget := chainCommand.String("target", "", "256-bit target as 64 hex digits, or compact nBits as 8 hex digits, instead of -d")
+	chainTimeout := chainCommand.Int("timeout", 360, "timeout in seconds for each block")
+	chainWorkers := chainCommand.Int("n", 1, "number of workers")
+	chainECS := chainCommand.Bool("use-ecs", false, "use ecs as a task scheduler")
+	chainLocal := chainCommand.Bool("local", false, "mine blocks on this machine rather than in the cloud")
+	chainAlgo := chainCommand.String("algo", nonce.SHA256D, "hashing algorithm: sha256d, sha256, sha3-256, blake2b-256, scrypt or argon2id")
+	chainAlgoParams := chainCommand.String("algo-params", "", "cost parameters for memory-hard algorithms, e.g. N=1024,r=1,p=1 or time=1,memory=4096,threads=1")
+	chainTransactions := chainCommand.String("transactions", "", "file of transactions, one per line, split between the blocks in place of -block")
+	chainRetarget := chainCommand.String("retarget", "", "difficulty retargeting of a new chain: periodic every -window blocks, or lwma over the last -window blocks (default the fixed -d or -target)")
+	chainBlockTime := chainCommand.Duration("block-time", time.Minute, "time each block should take when retargeting")
+	chainWindow := chainCommand.Int("window", 10, "number of blocks between periodic retargets, or averaged by lwma")
+	chainSimulate := chainCommand.Bool("simulate", false, "simulate mining statistically with -n workers rather than hashing, reporting the block times")
+	chainScale := chainCommand.String("scale", "", "changes to the number of simulated workers, as height:workers pairs such as 50:8,100:2")
+	chainHashRate := chainCommand.Float64("hash-rate", 0, "hashes per second of each simulated worker (default measured on this machine)")
+
+	// Merkle mode args
+	merkleTransactions := merkleCommand.String("transactions", "", "file of transactions, one per line")
+	merkleIndex := merkleCommand.Int("index", -1, "index of the transaction to print an inclusion proof of")
+	merkleVerify := merkleCommand.String("verify", "", "file holding an inclusion proof to verify against -root")
+	merkleRoot := merkleCommand.String("root", "", "merkle root to verify the proof against, defaulting to that of -transactions")
+
+	// Validate mode args
+	validateChain := validateCommand.String("chain", "chain.json", "chain file to check every block of")
+	validateBlockFile := validateCommand.String("block-file", "", "file holding a single block to check instead of -chain")
+	validateAlgo := validateCommand.String("algo", nonce.SHA256D, "hashing algorithm of -block-file, as chain files record their own")
+	validateAlgoParams := validateCommand.String("algo-params", "", "cost parameters of -block-file's hashing algorithm")
 
 	if len(os.Args) < 2 {
-		fmt.Println("direct or indirect subcommand is required")
+		fmt.Println("direct, indirect, verify, hashcash, chain, merkle or validate subcommand is required")
 		os.Exit(1)
 	}
 
 	switch os.Args[1] {
-	case "direct":
+	case DirectMode:
 		directCommand.Parse(os.Args[2:])
-	case "indirect":
+	case IndirectMode:
 		indirectCommand.Parse(os.Args[2:])
+	case VerifyMode:
+		verifyCommand.Parse(os.Args[2:])
+	case HashcashMode:
+		hashcashCommand.Parse(os.Args[2:])
+	case ChainMode:
+		chainCommand.Parse(os.Args[2:])
+	case MerkleMode:
+		merkleCommand.Parse(os.Args[2:])
+	case ValidateMode:
+		validateCommand.Parse(os.Args[2:])
 	default:
 		fmt.Println("[direct] mode")
 		directCommand.PrintDefaults()
 		fmt.Println("\n[indirect] mode")
 		indirectCommand.PrintDefaults()
+		fmt.Println("\n[verify] mode")
+		verifyCommand.PrintDefaults()
+		fmt.Println("\n[hashcash] mode")
+		hashcashCommand.PrintDefaults()
+		fmt.Println("\n[chain] mode")
+		chainCommand.PrintDefaults()
+		fmt.Println("\n[merkle] mode")
+		merkleCommand.PrintDefaults()
+		fmt.Println("\n[validate] mode")
+		validateCommand.PrintDefaults()
 		os.Exit(1)
 	}
 
@@ -85,17 +276,58 @@ func ParseArgs() (*WorkerConfig, error) {
 			return nil, errors.New("Invalid leading zeros, must be greater than 0")
 		} else if *directTimeout <= 0 {
 			return nil, errors.New("Invalid timeout, must be greater than 0")
+		} else if _, err := nonce.NewHasher(*directAlgo, *directAlgoParams); err != nil {
+			return nil, err
 		} else if *directWorkers <= 0 || *directWorkers >= 32 {
 			return nil, errors.New("Invalid number of workers, must be in range [0, 32)")
 		}
 
+		header, err := directHeader.parse()
+		if err != nil {
+			return nil, err
+		}
+
+		encoding, err := nonce.ParseEncoding(*directEncoding)
+		if err != nil {
+			return nil, err
+		}
+
+		order, err := parseOrder(*directOrder, *directSeed)
+		if err != nil {
+			return nil, err
+		}
+
+		target, err := parseTarget(*directTarget, *directLeadingZeros)
+		if err != nil {
+			return nil, err
+		}
+
+		pattern, err := parsePattern(*directPattern, header)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := validateEnumeration(*directAll, *directTopK, golden(target, pattern, header)); err != nil {
+			return nil, err
+		}
+
 		return &WorkerConfig{
+			Mode:         DirectMode,
 			Block:        directBlock,
 			LeadingZeros: *directLeadingZeros,
+			Target:       target,
+			Pattern:      pattern,
 			Timeout:      *directTimeout,
 			Workers:      *directWorkers,
 			Confidence:   100,
 			UseECS:       *directECS,
+			Algo:         *directAlgo,
+			AlgoParams:   *directAlgoParams,
+			Header:       header,
+			Encoding:     encoding,
+			Order:        order,
+			Enumerate:    *directAll || *directTopK > 0,
+			TopK:         *directTopK,
 		}, nil
 	}
 
@@ -110,28 +342,406 @@ func ParseArgs() (*WorkerConfig, error) {
 			return nil, errors.New("Invalid number of workers, must be in range [0, 100]")
 		}
 
-		workers := calculateWorkers(*indirectTimeout, *indirectConfidence)
+		hasher, err := nonce.NewHasher(*indirectAlgo, *indirectAlgoParams)
+		if err != nil {
+			return nil, err
+		}
+
+		header, err := indirectHeader.parse()
+		if err != nil {
+			return nil, err
+		}
+
+		encoding, err := nonce.ParseEncoding(*indirectEncoding)
+		if err != nil {
+			return nil, err
+		}
+
+		order, err := parseOrder(*indirectOrder, *indirectSeed)
+		if err != nil {
+			return nil, err
+		}
+
+		target, err := parseTarget(*indirectTarget, *indirectLeadingZeros)
+		if err != nil {
+			return nil, err
+		}
+
+		pattern, err := parsePattern(*indirectPattern, header)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := validateEnumeration(*indirectAll, *indirectTopK, golden(target, pattern, header)); err != nil {
+			return nil, err
+		}
+
+		// An enumeration has to search the whole nonce space
+		enumerate := *indirectAll || *indirectTopK > 0
+		confidence := *indirectConfidence
+		if enumerate {
+			confidence = 100
+		}
+
+		rate, err := hashRate(*indirectHashRate, &nonce.WorkerConfig{Contents: *indirectBlock, Encoding: encoding, Header: header, Hasher: hasher})
+		if err != nil {
+			return nil, err
+		}
+
+		workers := calculateWorkers(*indirectTimeout, confidence, rate, golden(target, pattern, header))
 		if workers >= 32 {
 			return nil, errors.New("Unable to satisfy constraints without using more than 32 workers")
 		}
 
 		return &WorkerConfig{
+			Mode:         IndirectMode,
 			Block:        indirectBlock,
 			LeadingZeros: *indirectLeadingZeros,
+			Target:       target,
+			Pattern:      pattern,
 			Timeout:      *indirectTimeout,
 			Confidence:   *indirectConfidence,
 			Workers:      workers,
 			UseECS:       *indirectECS,
+			Algo:         *indirectAlgo,
+			AlgoParams:   *indirectAlgoParams,
+			Header:       header,
+			Encoding:     encoding,
+			Order:        order,
+			Enumerate:    enumerate,
+			TopK:         *indirectTopK,
+		}, nil
+	}
+
+	if verifyCommand.Parsed() {
+		if *verifyNonce > math.MaxUint32 {
+			return nil, errors.New("Invalid nonce, must fit in 32 bits")
+		} else if *verifyExtraNonce > math.MaxUint32 {
+			return nil, errors.New("Invalid extra nonce, must fit in 32 bits")
+		} else if _, err := nonce.NewHasher(*verifyAlgo, *verifyAlgoParams); err != nil {
+			return nil, err
+		}
+
+		header, err := verifyHeader.parse()
+		if err != nil {
+			return nil, err
+		}
+
+		encoding, err := nonce.ParseEncoding(*verifyEncoding)
+		if err != nil {
+			return nil, err
+		}
+
+		target, err := parseTarget(*verifyTarget, *verifyLeadingZeros)
+		if err != nil {
+			return nil, err
+		}
+
+		pattern, err := parsePattern(*verifyPattern, header)
+		if err != nil {
+			return nil, err
+		}
+
+		return &WorkerConfig{
+			Mode:         VerifyMode,
+			Block:        verifyBlock,
+			LeadingZeros: *verifyLeadingZeros,
+			Target:       target,
+			Pattern:      pattern,
+			Algo:         *verifyAlgo,
+			AlgoParams:   *verifyAlgoParams,
+			Header:       header,
+			Encoding:     encoding,
+			Nonce:        uint32(*verifyNonce),
+			ExtraNonce:   uint32(*verifyExtraNonce),
+			ExpectedHash: *verifyHash,
+		}, nil
+	}
+
+	if hashcashCommand.Parsed() {
+		if len(*hashcashResource) == 0 {
+			return nil, errors.New("Invalid resource, must be non empty")
+		} else if *hashcashBits <= 0 || *hashcashBits > 160 {
+			return nil, errors.New("Invalid bits, must be in range (0, 160]")
+		} else if len(*hashcashVerify) == 0 && *hashcashBits > hashcash.MaxBits {
+			return nil, fmt.Errorf("Invalid bits, stamps can be minted with at most %d", hashcash.MaxBits)
+		} else if *hashcashCount <= 0 {
+			return nil, errors.New("Invalid count, must be greater than 0")
+		} else if *hashcashTimeout <= 0 {
+			return nil, errors.New("Invalid timeout, must be greater than 0")
+		} else if *hashcashWorkers <= 0 || *hashcashWorkers >= 32 {
+			return nil, errors.New("Invalid number of workers, must be in range [0, 32)")
+		} else if *hashcashMaxAge <= 0 {
+			return nil, errors.New("Invalid max age, must be greater than 0")
+		}
+
+		return &WorkerConfig{
+			Mode:         HashcashMode,
+			LeadingZeros: *hashcashBits,
+			Target:       nonce.TargetFromLeadingZeros(*hashcashBits),
+			Timeout:      *hashcashTimeout,
+			Workers:      *hashcashWorkers,
+			Confidence:   100,
+			UseECS:       *hashcashECS,
+			Algo:         nonce.SHA1,
+			Resource:     *hashcashResource,
+			Ext:          *hashcashExt,
+			Count:        *hashcashCount,
+			Local:        *hashcashLocal,
+			Stamp:        *hashcashVerify,
+			SeenStore:    *hashcashSeenStore,
+			MaxAge:       *hashcashMaxAge,
+		}, nil
+	}
+
+	if chainCommand.Parsed() {
+		if strings.Contains(*chainBlock, nonce.NoncePlaceholder) {
+			return nil, errors.New("Invalid data block, can't contain {nonce} in chain mode")
+		} else if *chainBlocks <= 0 {
+			return nil, errors.New("Invalid number of blocks, must be greater than 0")
+		} else if len(*chainOut) == 0 {
+			return nil, errors.New("Invalid chain file, must be non empty")
+		} else if *chainLeadingZeros <= 0 {
+			return nil, errors.New("Invalid leading zeros, must be greater than 0")
+		} else if *chainTimeout <= 0 {
+			return nil, errors.New("Invalid timeout, must be greater than 0")
+		} else if *chainWorkers <= 0 || *chainWorkers >= 32 {
+			return nil, errors.New("Invalid number of workers, must be in range [0, 32)")
+		}
+
+		target, err := parseTarget(*chainTarget, *chainLeadingZeros)
+		if err != nil {
+			return nil, err
+		}
+
+		var retarget *chain.Retarget
+		if len(*chainRetarget) > 0 {
+			retarget = &chain.Retarget{
+				Algorithm: *chainRetarget,
+				Interval:  int64(*chainBlockTime / time.Millisecond),
+				Window:    *chainWindow,
+			}
+			if err := retarget.Validate(); err != nil {
+				return nil, err
+			}
+		}
+
+		hasher, err := nonce.NewHasher(*chainAlgo, *chainAlgoParams)
+		if err != nil {
+			return nil, err
+		}
+
+		scale, err := parseScale(*chainScale)
+		if err != nil {
+			return nil, err
+		}
+
+		var transactions []string
+		if len(*chainTransactions) > 0 {
+			transactions, err = readTransactions(*chainTransactions)
+			if err != nil {
+				return nil, err
+			} else if len(transactions) < *chainBlocks {
+				return nil, errors.New("Invalid number of transactions, must be at least one per block")
+			}
+		}
+
+		// Only a simulation needs the hash rate
+		rate := *chainHashRate
+		if *chainSimulate {
+			rate, err = hashRate(rate, &nonce.WorkerConfig{Contents: *chainBlock, Hasher: hasher})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return &WorkerConfig{
+			Mode:         ChainMode,
+			Block:        chainBlock,
+			LeadingZeros: *chainLeadingZeros,
+			Target:       target,
+			Timeout:      *chainTimeout,
+			Workers:      *chainWorkers,
+			Confidence:   100,
+			UseECS:       *chainECS,
+			Algo:         *chainAlgo,
+			AlgoParams:   *chainAlgoParams,
+			Encoding:     nonce.DefaultEncoding,
+			Local:        *chainLocal,
+			Blocks:       *chainBlocks,
+			ChainFile:    *chainOut,
+			Transactions: transactions,
+			Retarget:     retarget,
+			Simulate:     *chainSimulate,
+			HashRate:     rate,
+			Scale:        scale,
+		}, nil
+	}
+
+	if merkleCommand.Parsed() {
+		if len(*merkleVerify) == 0 && len(*merkleTransactions) == 0 {
+			return nil, errors.New("Invalid transactions file, must be non empty")
+		} else if len(*merkleVerify) > 0 && len(*merkleRoot) == 0 && len(*merkleTransactions) == 0 {
+			return nil, errors.New("Invalid root, must be given to verify a proof without -transactions")
+		}
+
+		var transactions []string
+		if len(*merkleTransactions) > 0 {
+			var err error
+			transactions, err = readTransactions(*merkleTransactions)
+			if err != nil {
+				return nil, err
+			} else if *merkleIndex >= len(transactions) {
+				return nil, fmt.Errorf("Invalid index, must be in range [0, %d)", len(transactions))
+			}
+		}
+
+		return &WorkerConfig{
+			Mode:         MerkleMode,
+			Transactions: transactions,
+			ProofIndex:   *merkleIndex,
+			ProofFile:    *merkleVerify,
+			Root:         *merkleRoot,
+		}, nil
+	}
+
+	if validateCommand.Parsed() {
+		if len(*validateChain) == 0 && len(*validateBlockFile) == 0 {
+			return nil, errors.New("Invalid chain file, must be non empty")
+		} else if _, err := nonce.NewHasher(*validateAlgo, *validateAlgoParams); err != nil {
+			return nil, err
+		}
+
+		return &WorkerConfig{
+			Mode:       ValidateMode,
+			ChainFile:  *validateChain,
+			BlockFile:  *validateBlockFile,
+			Algo:       *validateAlgo,
+			AlgoParams: *validateAlgoParams,
 		}, nil
 	}
 
 	return nil, errors.New("Unable to parse CLI args")
 }
 
-func calculateWorkers(timeout int, confidence int) int {
-	totalNumbersToSearch := ^uint32(0)
-	numberOfSecondsNeeded := float64(totalNumbersToSearch) / float64(noncesProcessedPerSecond)
+// hashRate returns the given hash rate if there is one. Otherwise it measures config's search on this machine,
+// assuming each worker hashes as fast.
+func hashRate(given float64, config *nonce.WorkerConfig) (float64, error) {
+	if given < 0 {
+		return 0, errors.New("Invalid hash rate, must be at least 0")
+	} else if given > 0 {
+		return given, nil
+	}
+
+	rate, err := nonce.MeasureHashRate(config, calibrationTime)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("Measured %.3g hashes per second on this machine", rate)
+	return rate, nil
+}
+
+// parseOrder reads the -order flag's kind and lanes, and keys it with seed
+func parseOrder(order string, seed uint64) (nonce.Order, error) {
+	o, err := nonce.ParseOrder(order)
+	if err != nil {
+		return nonce.Order{}, err
+	} else if strings.Count(order, ":") > 1 {
+		return nonce.Order{}, errors.New("Invalid order, the seed must be given with -seed")
+	} else if o.Workers > 0 {
+		return nonce.Order{}, errors.New("Invalid order, the client assigns each worker its share of a strided search")
+	}
+	o.Seed = seed
+	return o, nil
+}
+
+// parseScale reads the -scale flag's height:workers pairs, which must be in order of height
+func parseScale(scale string) ([]ScaleStep, error) {
+	if len(scale) == 0 {
+		return nil, nil
+	}
+
+	var steps []ScaleStep
+	for _, pair := range strings.Split(scale, ",") {
+		var step ScaleStep
+		if _, err := fmt.Sscanf(pair, "%d:%d", &step.Height, &step.Workers); err != nil {
+			return nil, fmt.Errorf("Invalid scale %q, must be height:workers pairs", pair)
+		} else if step.Workers <= 0 {
+			return nil, errors.New("Invalid scale, workers must be greater than 0")
+		} else if len(steps) > 0 && step.Height <= steps[len(steps)-1].Height {
+			return nil, errors.New("Invalid scale, heights must be increasing")
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// validateEnumeration checks the -all and -top-k flags, which select different kinds of enumeration. Every golden
+// nonce is kept in memory and sent back, so -all is only allowed if few are expected over the nonce space.
+func validateEnumeration(all bool, topK int, golden nonce.Predicate) error {
+	if topK < 0 {
+		return errors.New("Invalid top k, must be at least 0")
+	} else if all && topK > 0 {
+		return errors.New("Invalid enumeration, must use only one of -all and -top-k")
+	} else if expected := golden.Probability() * float64(nonce.NonceSpace); all && expected > nonce.MaxEnumerated {
+		return fmt.Errorf("Invalid enumeration, %.3g golden nonces are expected but at most %d can be kept, use a harder target or -top-k", expected, nonce.MaxEnumerated)
+	}
+	return nil
+}
+
+// golden returns what a hash is compared against: the header's own target in header mode, or else the pattern if
+// there is one, or else the target
+func golden(target nonce.Target, pattern *nonce.Pattern, header *nonce.BlockHeader) nonce.Predicate {
+	if header != nil {
+		return header.Target()
+	} else if pattern != nil {
+		return pattern
+	}
+	return target
+}
+
+// parseTarget reads the -target flag, falling back to a target of the given number of leading zeros
+func parseTarget(target string, leadingZeros int) (nonce.Target, error) {
+	if len(target) == 0 {
+		return nonce.TargetFromLeadingZeros(leadingZeros), nil
+	}
+
+	t, err := nonce.ParseTarget(target)
+	if err != nil {
+		return t, err
+	} else if t.IsZero() {
+		return t, errors.New("Invalid target, must be greater than 0")
+	}
+	return t, nil
+}
+
+// parsePattern reads the -pattern flag, returning nil if it wasn't given
+func parsePattern(pattern string, header *nonce.BlockHeader) (*nonce.Pattern, error) {
+	if len(pattern) == 0 {
+		return nil, nil
+	} else if header != nil {
+		return nil, errors.New("Invalid pattern, can't be used in header mode")
+	}
+
+	p, err := nonce.ParsePattern(pattern)
+	if err != nil {
+		return nil, err
+	} else if p.Probability() == 0 {
+		return nil, errors.New("Invalid pattern, no hex digest can match it")
+	}
+	return p, nil
+}
+
+// calculateWorkers estimates how many workers are needed to find a golden nonce within the timeout with the
+// given percentage confidence. Searching the whole nonce space is the most that can be done.
+func calculateWorkers(timeout int, confidence int, hashRate float64, golden nonce.Predicate) int {
+	totalNumbersToSearch := float64(nonce.NonceSpace)
+	if confidence < 100 {
+		// Each hash succeeds independently with probability p, so n hashes succeed with probability 1 - (1 - p)^n
+		needed := math.Log1p(-float64(confidence)*0.01) / math.Log1p(-golden.Probability())
+		totalNumbersToSearch = math.Min(totalNumbersToSearch, needed)
+	}
+	numberOfSecondsNeeded := totalNumbersToSearch / hashRate
 	workersNeededToFullySearch := numberOfSecondsNeeded / float64(timeout)
-	workersNeededForConfidence := math.Ceil(workersNeededToFullySearch * float64(confidence) * 0.01)
-	return int(workersNeededForConfidence)
+	return int(math.Max(1, math.Ceil(workersNeededToFullySearch)))
 }
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jaylees14/pow/worker/merkle"
+	"github.com/jaylees14/pow/worker/nonce"
+)
+
+// headerArgs are the flags describing a Bitcoin block header, shared by both modes
+type headerArgs struct {
+	version    *int
+	prevHash   *string
+	merkleRoot *string
+	// transactions is a file whose Merkle root is used instead of merkleRoot
+	transactions *string
+	timestamp    *uint
+	bits         *string
+}
+
+func addHeaderArgs(command *flag.FlagSet) *headerArgs {
+	return &headerArgs{
+		version:      command.Int("header-version", 1, "block version in header mode"),
+		prevHash:     command.String("prev-hash", strings.Repeat("0", 64), "previous block hash in header mode"),
+		merkleRoot:   command.String("merkle-root", "", "merkle root, mining a Bitcoin block header instead of -block when set"),
+		transactions: command.String("transactions", "", "file of transactions, one per line, whose merkle root is used instead of -merkle-root"),
+		timestamp:    command.Uint("timestamp", 0, "block timestamp in header mode, as unix time (default now)"),
+		bits:         command.String("bits", "1d00ffff", "compact difficulty target (nBits) in header mode, as hex"),
+	}
+}
+
+// parse builds the block header, or returns nil if header mode wasn't requested. Given transactions, the first is
+// the coinbase which the extra nonce is rolled into.
+func (args *headerArgs) parse() (*nonce.BlockHeader, error) {
+	merkleRoot := *args.merkleRoot
+	var tree *merkle.Tree
+	var coinbase []byte
+	if len(*args.transactions) > 0 {
+		if len(merkleRoot) > 0 {
+			return nil, errors.New("Invalid merkle root, must use only one of -merkle-root and -transactions")
+		}
+		txs, err := merkle.ReadTransactions(*args.transactions)
+		if err != nil {
+			return nil, err
+		}
+		tree, err = merkle.FromTransactions(txs)
+		if err != nil {
+			return nil, err
+		}
+		merkleRoot = tree.Root().String()
+		coinbase = txs[0]
+	}
+	if len(merkleRoot) == 0 {
+		return nil, nil
+	}
+
+	bits, err := strconv.ParseUint(*args.bits, 16, 32)
+	if err != nil {
+		return nil, errors.New("Invalid bits, must be a 32-bit hex number")
+	}
+
+	timestamp := *args.timestamp
+	if timestamp == 0 {
+		timestamp = uint(time.Now().Unix())
+	} else if timestamp > math.MaxUint32 {
+		return nil, errors.New("Invalid timestamp, must fit in 32 bits")
+	}
+
+	if *args.version < math.MinInt32 || *args.version > math.MaxInt32 {
+		return nil, errors.New("Invalid header version, must fit in 32 bits")
+	}
+	header, err := nonce.NewBlockHeader(int32(*args.version), *args.prevHash, merkleRoot, uint32(timestamp), uint32(bits))
+	if err != nil || tree == nil {
+		return header, err
+	}
+
+	proof, err := tree.Proof(0)
+	if err != nil {
+		return nil, err
+	}
+	header.Coinbase = coinbase
+	header.Branch = proof.Siblings
+	return header, nil
+}
+
+// readTransactions reads a file of transactions, one per line
+func readTransactions(path string) ([]string, error) {
+	txs, err := merkle.ReadTransactions(path)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := make([]string, len(txs))
+	for i, tx := range txs {
+		transactions[i] = string(tx)
+	}
+	return transactions, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	cloudsession "github.com/jaylees14/pow/client/cloud-session"
+	"github.com/jaylees14/pow/client/cmd"
+	"github.com/jaylees14/pow/worker/hashcash"
+	"github.com/jaylees14/pow/worker/nonce"
+)
+
+// runHashcash verifies the given stamp, or mints new ones locally or in the cloud, printing them to stdout
+func runHashcash(config *cmd.WorkerConfig) {
+	if len(config.Stamp) > 0 {
+		verifyStamp(config)
+		return
+	}
+
+	log.Printf("Minting %d stamp(s) for %s with %d bits", config.Count, config.Resource, config.LeadingZeros)
+
+	if config.Local {
+		for i := 0; i < config.Count; i++ {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Timeout)*time.Second)
+			stamp, err := hashcash.Mint(ctx, config.Resource, config.LeadingZeros, config.Ext)
+			cancel()
+			checkError(err, "Couldn't mint stamp", nil)
+			fmt.Println(stamp)
+		}
+		return
+	}
+
+	cloudSession := newCloudSession(config)
+	for i := 0; i < config.Count; i++ {
+		stamp, err := mintInCloud(config, cloudSession)
+		checkError(err, "Couldn't mint stamp", cloudSession)
+		fmt.Println(stamp)
+	}
+	cloudSession.Cleanup()
+}
+
+// mintInCloud searches for one stamp's counter across the cloud session's workers
+func mintInCloud(config *cmd.WorkerConfig, cloudSession *cloudsession.CloudSession) (*hashcash.Stamp, error) {
+	stamp, err := hashcash.NewStamp(config.Resource, config.LeadingZeros, config.Ext)
+	if err != nil {
+		return nil, err
+	}
+
+	stampConfig := stamp.Config()
+	search := *config
+	search.Block = &stampConfig.Contents
+	search.Encoding = stampConfig.Encoding
+	search.Target = stampConfig.Target
+
+	partitioner := newWorkPartitioner(&search, cloudSession)
+	if err := partitioner.partitionWork(); err != nil {
+		return nil, err
+	}
+
+	response, err := cloudSession.WaitForResponse(partitioner.searchID, config.Timeout, func(*cloudsession.WorkerResponse) (bool, error) {
+		return partitioner.sendNext()
+	})
+	// The other workers are still searching for this stamp, and would hold up the next one
+	partitioner.cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := strconv.ParseUint(*response.Nonce, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	extraNonce, err := strconv.ParseUint(*response.ExtraNonce, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	stamp.Solved(&nonce.GoldenNonce{Nonce: uint32(n), ExtraNonce: uint32(extraNonce)})
+
+	// Checking a stamp costs a single hash, so don't trust the worker
+	if stamp.LeadingZeros() < stamp.Bits {
+		return nil, errors.New("Worker returned a stamp without enough bits")
+	}
+	return stamp, nil
+}
+
+// verifyStamp checks the given stamp, exiting with a non-zero status if it is invalid
+func verifyStamp(config *cmd.WorkerConfig) {
+	verifier := &hashcash.Verifier{Bits: config.LeadingZeros, MaxAge: config.MaxAge}
+
+	var store *hashcash.FileStore
+	if len(config.SeenStore) > 0 {
+		var err error
+		store, err = hashcash.OpenFileStore(config.SeenStore)
+		checkError(err, "Couldn't open seen store", nil)
+		verifier.Store = store
+	}
+
+	stamp, err := verifier.Verify(config.Stamp, config.Resource)
+	if store != nil {
+		store.Close()
+	}
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+	log.Printf("Valid stamp with %d bits, dated %s", stamp.LeadingZeros(), stamp.Date.Format(time.RFC3339))
+}
@@ -6,10 +6,15 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	cloudsession "github.com/jaylees14/pow/client/cloud-session"
 	"github.com/jaylees14/pow/client/cmd"
+	"github.com/jaylees14/pow/worker/merkle"
+	"github.com/jaylees14/pow/worker/nonce"
 )
 
 const (
@@ -41,17 +46,31 @@ func configureSIGTERMHandler(session *cloudsession.CloudSession) {
 	}()
 }
 
+// workPartitioner hands out (extra nonce, nonce range) partitions to the workers. Once every range of the
+// 32-bit nonce space has been handed out it moves on to the next extra nonce, until the deadline passes.
+type workPartitioner struct {
+	// searchID tags this search's jobs, so responses to any earlier search on the session are ignored
+	searchID     string
+	config       *cmd.WorkerConfig
+	cloudSession *cloudsession.CloudSession
+	deadline     time.Time
+	extraNonce   uint32
+	next         uint32
+}
+
+func newWorkPartitioner(config *cmd.WorkerConfig, cloudSession *cloudsession.CloudSession) *workPartitioner {
+	return &workPartitioner{
+		searchID:     strconv.FormatInt(time.Now().UnixNano(), 36),
+		config:       config,
+		cloudSession: cloudSession,
+		deadline:     time.Now().Add(time.Duration(config.Timeout) * time.Second),
+	}
+}
+
 // Partition the work between each of the workers
-func partitionWork(config *cmd.WorkerConfig, cloudSession *cloudsession.CloudSession) error {
-	maxValue := ^uint32(0)
-	split := maxValue / uint32(config.Workers)
-	for i := uint32(0); i < uint32(config.Workers); i++ {
-		startValue := i * split
-		endValue := (i + 1) * split
-		if i == uint32(config.Workers)-1 {
-			endValue = maxValue
-		}
-		err := cloudSession.SendMessageOnQueue(cloudsession.InputQueue, config.Block, startValue, endValue, config.LeadingZeros)
+func (wp *workPartitioner) partitionWork() error {
+	for i := 0; i < wp.config.Workers; i++ {
+		_, err := wp.sendNext()
 		if err != nil {
 			return err
 		}
@@ -59,16 +78,147 @@ func partitionWork(config *cmd.WorkerConfig, cloudSession *cloudsession.CloudSes
 	return nil
 }
 
-func main() {
-	config, err := cmd.ParseArgs()
-	checkError(err, "Couldn't parse arguments: ", nil)
+// sendNext sends the next partition to the input queue, reporting false if the deadline has already passed or a
+// header without a coinbase can't be rolled any further
+func (wp *workPartitioner) sendNext() (bool, error) {
+	remaining := int(time.Until(wp.deadline).Seconds())
+	if remaining <= 0 {
+		return false, nil
+	} else if header := wp.config.Header; header != nil && header.Coinbase == nil && wp.extraNonce > nonce.MaxTimestampRoll {
+		return false, nil
+	}
 
-	config.LogConfig()
+	split := nonce.NonceSpace / uint64(wp.config.Workers)
+	startValue := uint64(wp.next) * split
+	endValue := startValue + split
+	if wp.next == uint32(wp.config.Workers)-1 {
+		endValue = nonce.NonceSpace
+	}
 
+	// A strided search interleaves the workers across the whole nonce space, rather than giving each a block of it
+	order := wp.config.Order
+	if order.Kind == nonce.Strided && wp.config.Workers > 1 {
+		startValue, endValue = 0, nonce.NonceSpace
+		order.Worker, order.Workers = int(wp.next), wp.config.Workers
+	}
+
+	err := wp.cloudSession.SendMessageOnQueue(cloudsession.InputQueue, &cloudsession.Job{
+		SearchID:   wp.searchID,
+		Block:      wp.config.Block,
+		LowerBound: uint32(startValue),
+		UpperBound: endValue,
+		ExtraNonce: wp.extraNonce,
+		Target:     wp.config.Target,
+		Pattern:    wp.config.Pattern,
+		Timeout:    remaining,
+		Algo:       wp.config.Algo,
+		AlgoParams: wp.config.AlgoParams,
+		Header:     wp.config.Header,
+		Encoding:   wp.config.Encoding,
+		Order:      order,
+		Enumerate:  wp.config.Enumerate,
+		TopK:       wp.config.TopK,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	wp.next++
+	if wp.next == uint32(wp.config.Workers) {
+		wp.next = 0
+		wp.extraNonce++
+		log.Printf("Nonce space handed out, rolling extra nonce to %d", wp.extraNonce)
+	}
+	return true, nil
+}
+
+// cancel tells the workers the search is over, so they don't spend any longer on its partitions. A failure to
+// cancel only wastes their time, so it's logged rather than fatal.
+func (wp *workPartitioner) cancel() {
+	if err := wp.cloudSession.CancelSearch(wp.searchID); err != nil {
+		log.Printf("Couldn't cancel search %s: %s", wp.searchID, err.Error())
+	}
+}
+
+// verifyNonce recomputes the hash for the configured nonce offline, exiting non-zero if it isn't golden
+func verifyNonce(config *cmd.WorkerConfig) {
+	hasher, err := nonce.NewHasher(config.Algo, config.AlgoParams)
+	checkError(err, "Couldn't create hasher", nil)
+	if config.Header != nil {
+		_, err = config.Header.Rolled(config.ExtraNonce)
+		checkError(err, "Couldn't roll header", nil)
+	}
+
+	hash, ok := nonce.VerifyConfig(&nonce.WorkerConfig{
+		Contents:   *config.Block,
+		Target:     config.Target,
+		Pattern:    config.Pattern,
+		ExtraNonce: config.ExtraNonce,
+		Header:     config.Header,
+		Encoding:   config.Encoding,
+		Hasher:     hasher,
+	}, config.Nonce)
+	log.Printf("Hash: %s", hash)
+
+	if len(config.ExpectedHash) > 0 && !strings.EqualFold(hash, config.ExpectedHash) {
+		log.Printf("Invalid: hash doesn't match expected hash %s", config.ExpectedHash)
+		os.Exit(1)
+	} else if !ok && config.Pattern != nil {
+		log.Printf("Invalid: hash doesn't match the pattern")
+		os.Exit(1)
+	} else if !ok {
+		log.Printf("Invalid: hash doesn't meet the target")
+		os.Exit(1)
+	}
+	log.Printf("Valid golden nonce %d", config.Nonce)
+}
+
+// logRolledHeader shows what a block header found with a non-zero extra nonce must hold instead, so that the block
+// can be rebuilt
+func logRolledHeader(header *nonce.BlockHeader, extraNonce string) {
+	n, err := strconv.ParseUint(extraNonce, 10, 32)
+	if header == nil || err != nil || n == 0 {
+		return
+	}
+
+	rolled, err := header.Rolled(uint32(n))
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	if header.Coinbase != nil {
+		log.Printf("Coinbase rolled to %x, giving merkle root %s", rolled.RolledCoinbase(uint32(n)), merkle.Hash(rolled.MerkleRoot))
+	} else {
+		log.Printf("Timestamp rolled to %d", rolled.Timestamp)
+	}
+}
+
+// enumerate collects the nonces found by workers scanning the whole nonce space once, and reports on them
+func enumerate(config *cmd.WorkerConfig, cloudSession *cloudsession.CloudSession, searchID string) {
+	report := &enumerationReport{
+		target: config.Target,
+		topK:   config.TopK,
+	}
+	if config.Header != nil {
+		report.target = config.Header.Target()
+	} else if config.Pattern != nil {
+		report.target = config.Pattern
+	}
+
+	log.Printf("Enumerating nonce space")
+	err := cloudSession.WaitForEnumeration(searchID, config.Timeout, report.add)
+	if err != nil {
+		// Still report what was found by the workers which finished
+		log.Printf("Incomplete enumeration: %s", err.Error())
+	}
+	report.print()
+}
+
+// newCloudSession sets up the cloud infrastructure, VMs etc., for config's number of workers
+func newCloudSession(config *cmd.WorkerConfig) *cloudsession.CloudSession {
 	iamTrustJSON, err := ioutil.ReadFile(iamTrustRelationshipJSONPath)
 	checkError(err, "Couldn't read iam trust relationship JSON", nil)
 
-	// Set up the cloud infra, VMs etc.
 	var cloudSession *cloudsession.CloudSession
 
 	if config.UseECS {
@@ -94,17 +244,59 @@ func main() {
 
 	// Configure Ctrl-C handler to perform graceful shutdown
 	configureSIGTERMHandler(cloudSession)
+	return cloudSession
+}
+
+func main() {
+	config, err := cmd.ParseArgs()
+	checkError(err, "Couldn't parse arguments: ", nil)
+
+	if config.Mode == cmd.VerifyMode {
+		verifyNonce(config)
+		return
+	} else if config.Mode == cmd.HashcashMode {
+		runHashcash(config)
+		return
+	} else if config.Mode == cmd.ChainMode {
+		runChain(config)
+		return
+	} else if config.Mode == cmd.MerkleMode {
+		runMerkle(config)
+		return
+	} else if config.Mode == cmd.ValidateMode {
+		runValidate(config)
+		return
+	}
 
-	err = partitionWork(config, cloudSession)
+	config.LogConfig()
+
+	cloudSession := newCloudSession(config)
+
+	partitioner := newWorkPartitioner(config, cloudSession)
+	err = partitioner.partitionWork()
 	checkError(err, "Couldn't send message", cloudSession)
 
+	if config.Enumerate {
+		enumerate(config, cloudSession, partitioner.searchID)
+		cloudSession.Cleanup()
+		return
+	}
+
 	log.Printf("Computing golden nonce")
 
-	success, err := cloudSession.WaitForResponse(config.Timeout)
+	failures := &failureReport{}
+	success, err := cloudSession.WaitForResponse(partitioner.searchID, config.Timeout, func(response *cloudsession.WorkerResponse) (bool, error) {
+		failures.add(response)
+		return partitioner.sendNext()
+	})
+	if err != nil {
+		failures.print()
+	}
 	checkError(err, "Didn't receive response", cloudSession)
 
 	if success.Success {
-		log.Printf("Success! Found golden nonce %s with hash %s", *success.Nonce, *success.Hash)
+		log.Printf("Success! Found golden nonce %s (extra nonce %s) with hash %s", *success.Nonce, *success.ExtraNonce, *success.Hash)
+		logRolledHeader(config.Header, *success.ExtraNonce)
 	} else {
 		log.Printf("Failure: no nonce found")
 	}
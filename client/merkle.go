@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/jaylees14/pow/client/cmd"
+	"github.com/jaylees14/pow/worker/merkle"
+)
+
+// runMerkle prints the Merkle root of the transactions, or an inclusion proof of one of them to stdout, or checks
+// a proof, exiting with a non-zero status if it is invalid
+func runMerkle(config *cmd.WorkerConfig) {
+	var tree *merkle.Tree
+	if len(config.Transactions) > 0 {
+		txs := make([][]byte, len(config.Transactions))
+		for i, tx := range config.Transactions {
+			txs[i] = []byte(tx)
+		}
+		var err error
+		tree, err = merkle.FromTransactions(txs)
+		checkError(err, "Couldn't build merkle tree", nil)
+	}
+
+	if len(config.ProofFile) > 0 {
+		verifyProof(config, tree)
+		return
+	}
+
+	log.Printf("Merkle root of %d transaction(s): %s", tree.Len(), tree.Root())
+	if config.ProofIndex >= 0 {
+		proof, err := tree.Proof(config.ProofIndex)
+		checkError(err, "Couldn't create proof", nil)
+		data, err := json.MarshalIndent(proof, "", "  ")
+		checkError(err, "Couldn't encode proof", nil)
+		fmt.Println(string(data))
+	}
+}
+
+// verifyProof checks the proof in the proof file against the given root, or else that of tree
+func verifyProof(config *cmd.WorkerConfig, tree *merkle.Tree) {
+	data, err := ioutil.ReadFile(config.ProofFile)
+	checkError(err, "Couldn't read proof", nil)
+	proof := &merkle.Proof{}
+	err = json.Unmarshal(data, proof)
+	checkError(err, "Couldn't decode proof", nil)
+
+	var root merkle.Hash
+	if len(config.Root) > 0 {
+		root, err = merkle.ParseHash(config.Root)
+		checkError(err, "Couldn't parse root", nil)
+	} else {
+		root = tree.Root()
+	}
+
+	if !proof.Verify(root) {
+		log.Printf("Invalid: transaction %s isn't at index %d under merkle root %s", proof.Leaf, proof.Index, root)
+		os.Exit(1)
+	}
+	log.Printf("Valid proof of transaction %s at index %d under merkle root %s", proof.Leaf, proof.Index, root)
+}
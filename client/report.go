@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/hex"
+	"log"
+	"math/bits"
+	"sort"
+	"strconv"
+
+	cloudsession "github.com/jaylees14/pow/client/cloud-session"
+	"github.com/jaylees14/pow/worker/nonce"
+)
+
+// enumerationReport aggregates the nonces streamed back by every enumerating worker
+type enumerationReport struct {
+	target nonce.Predicate
+	topK   int
+	hashes uint64
+	nonces []nonce.GoldenNonce
+}
+
+// add merges a worker's response into the report, only keeping the overall lowest hashes in top-k mode
+func (r *enumerationReport) add(response *cloudsession.WorkerResponse) {
+	// Each chunk carries the worker's total, so it is only counted once
+	if response.Final {
+		r.hashes += response.Enumeration.Hashes
+	}
+
+	r.nonces = append(r.nonces, response.Enumeration.Nonces...)
+	if r.topK > 0 && len(r.nonces) > r.topK {
+		r.sort()
+		r.nonces = r.nonces[:r.topK]
+	}
+}
+
+// sort orders the nonces from the lowest hash. Hashes are hex of equal length, so they order the same as the
+// numbers they encode.
+func (r *enumerationReport) sort() {
+	sort.Slice(r.nonces, func(i, j int) bool {
+		return r.nonces[i].Hash < r.nonces[j].Hash
+	})
+}
+
+// print logs every nonce in the report, and compares the density of golden nonces with what the target or pattern predicts
+func (r *enumerationReport) print() {
+	r.sort()
+	log.Printf("--- Enumeration report ---")
+	for i, n := range r.nonces {
+		log.Printf("%d: nonce %d (extra nonce %d) with hash %s, %d leading zeros", i+1, n.Nonce, n.ExtraNonce, n.Hash, hashLeadingZeros(n.Hash))
+	}
+	log.Printf("Hashes computed: %d", r.hashes)
+
+	if r.topK == 0 && r.hashes > 0 {
+		observed := float64(len(r.nonces)) / float64(r.hashes)
+		expected := r.target.Probability()
+		log.Printf("Golden nonces: %d, expected %.2f", len(r.nonces), expected*float64(r.hashes))
+		log.Printf("Solution density: %.4g observed, %.4g expected (ratio %.3f)", observed, expected, observed/expected)
+	}
+	log.Printf("--------------------------")
+}
+
+// failureReport keeps the best hash reported by any worker which failed to find a golden nonce, and how many
+// hashes they computed between them
+type failureReport struct {
+	best   *cloudsession.WorkerResponse
+	hashes uint64
+}
+
+// add merges a failed worker's response into the report
+func (r *failureReport) add(response *cloudsession.WorkerResponse) {
+	if response.Hashes != nil {
+		if hashes, err := strconv.ParseUint(*response.Hashes, 10, 64); err == nil {
+			r.hashes += hashes
+		}
+	}
+	if response.Hash != nil && (r.best == nil || *response.Hash < *r.best.Hash) {
+		r.best = response
+	}
+}
+
+// print logs the best hash found overall, showing how close the run came to finding a golden nonce
+func (r *failureReport) print() {
+	if r.best != nil {
+		log.Printf("Best hash %s from nonce %s (extra nonce %s), %s leading zeros", *r.best.Hash, *r.best.Nonce, *r.best.ExtraNonce, *r.best.LeadingZeros)
+	}
+	log.Printf("Hashes computed: %d", r.hashes)
+}
+
+// hashLeadingZeros counts the leading zero bits of a hex encoded hash
+func hashLeadingZeros(hash string) int {
+	b, err := hex.DecodeString(hash)
+	if err != nil {
+		return 0
+	}
+	for i, v := range b {
+		if v != 0 {
+			return i*8 + bits.LeadingZeros8(v)
+		}
+	}
+	return len(b) * 8
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jaylees14/pow/client/cmd"
+	"github.com/jaylees14/pow/worker/chain"
+	"github.com/jaylees14/pow/worker/nonce"
+)
+
+// runValidate checks every block of the chain file in order, or the single block file, printing a report of each
+// block to stdout and exiting with a non-zero status at the first invalid one
+func runValidate(config *cmd.WorkerConfig) {
+	now := time.Now()
+	if len(config.BlockFile) > 0 {
+		b, err := chain.LoadBlock(config.BlockFile)
+		checkError(err, "Couldn't load block", nil)
+		hasher, err := nonce.NewHasher(config.Algo, config.AlgoParams)
+		checkError(err, "Couldn't create hasher", nil)
+
+		if err := b.Check(hasher, now); err != nil {
+			log.Print(err)
+			os.Exit(1)
+		}
+		reportBlock(b, nil)
+		log.Printf("Valid block %d, though its link to the block before it can't be checked on its own", b.Index)
+		return
+	}
+
+	c, err := chain.Load(config.ChainFile)
+	checkError(err, "Couldn't load chain", nil)
+	for i, b := range c.Blocks {
+		if err := c.Check(i, now); err != nil {
+			log.Print(err)
+			os.Exit(1)
+		}
+		var prev *chain.Block
+		if i > 0 {
+			prev = c.Blocks[i-1]
+		}
+		reportBlock(b, prev)
+	}
+	log.Printf("Valid chain of %d block(s) mined with %s", len(c.Blocks), c.Algo)
+}
+
+// reportBlock prints a line about a valid block, and how its target and timestamp moved on from prev, if it has one
+func reportBlock(b *chain.Block, prev *chain.Block) {
+	contents := fmt.Sprintf("payload %q", b.Payload)
+	if len(b.Transactions) > 0 {
+		contents = fmt.Sprintf("%d transaction(s) under merkle root %s", len(b.Transactions), b.MerkleRoot)
+	}
+
+	target := fmt.Sprintf("target %s", b.Target)
+	if prev != nil && prev.Target != b.Target {
+		target = fmt.Sprintf("retargeted from %s to %s", prev.Target, b.Target)
+	}
+
+	after := ""
+	if prev != nil {
+		after = fmt.Sprintf(", %s after block %d", b.Time().Sub(prev.Time()), prev.Index)
+	}
+	fmt.Printf("Block %d: hash %s, %s, %s, %s%s\n", b.Index, b.Hash, contents, target, b.Time().UTC().Format(time.RFC3339), after)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+const (
+	cancelQueueName string = "CANCEL_QUEUE"
+	// cancelRetention is how long the client's messages are kept on the cancel queue, after which a worker forgets
+	// them too
+	cancelRetention = time.Minute
+	// cancelPollInterval is how long the worker waits between checks of the cancel queue, which must be well within
+	// cancelRetention
+	cancelPollInterval = 2 * time.Second
+)
+
+// cancellations tracks the searches the client has finished with, so that the running job is stopped if it
+// belongs to one, and any later jobs of theirs are dropped
+type cancellations struct {
+	mu sync.Mutex
+	// cancelled holds when each cancelled search was first seen
+	cancelled map[string]time.Time
+	// searchID is the search of the running job, which cancel stops
+	searchID string
+	cancel   context.CancelFunc
+}
+
+func newCancellations() *cancellations {
+	return &cancellations{cancelled: make(map[string]time.Time)}
+}
+
+// isCancelled reports whether the client has finished with searchID
+func (c *cancellations) isCancelled(searchID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.cancelled[searchID]
+	return ok
+}
+
+// add records that searchID is over at now, stopping the running job if it belongs to it
+func (c *cancellations) add(searchID string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.cancelled[searchID]; ok {
+		return
+	}
+	c.cancelled[searchID] = now
+	if c.cancel != nil && c.searchID == searchID {
+		log.Printf("Search %s was cancelled", searchID)
+		c.cancel()
+	}
+}
+
+// start registers the running job, which cancel stops if its search is cancelled, straight away if it already is
+func (c *cancellations) start(searchID string, cancel context.CancelFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.searchID, c.cancel = searchID, cancel
+	if _, ok := c.cancelled[searchID]; ok {
+		cancel()
+	}
+}
+
+// finish unregisters the running job
+func (c *cancellations) finish() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.searchID, c.cancel = "", nil
+}
+
+// expire forgets the searches first seen more than cancelRetention before now, whose messages have left the queue
+func (c *cancellations) expire(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for searchID, seen := range c.cancelled {
+		if now.Sub(seen) > cancelRetention {
+			delete(c.cancelled, searchID)
+		}
+	}
+}
+
+// poll reads the cancel queue until ctx is done. Every worker needs to see each message, so they are left on the
+// queue for SQS to expire rather than deleted. An error only skips a check, as the worker keeps running without
+// cancellations.
+func (c *cancellations) poll(ctx context.Context, session *session.Session) {
+	for ctx.Err() == nil {
+		now := time.Now()
+		c.expire(now)
+		messages, err := getCancelMessages(session)
+		if err != nil {
+			log.Printf("Couldn't receive cancellations: %s", err.Error())
+		} else {
+			for _, message := range messages.Messages {
+				c.add(*message.Body, now)
+			}
+		}
+		time.Sleep(cancelPollInterval)
+	}
+}
+
+func getCancelMessages(session *session.Session) (*sqs.ReceiveMessageOutput, error) {
+	svc := sqs.New(session)
+	// Get QueueURL
+	resultURL, err := svc.GetQueueUrl(&sqs.GetQueueUrlInput{
+		QueueName: aws.String(cancelQueueName),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return svc.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:            resultURL.QueueUrl,
+		MaxNumberOfMessages: aws.Int64(10),
+		// Leave the messages visible to the other workers
+		VisibilityTimeout: aws.Int64(0),
+	})
+}
@@ -0,0 +1,222 @@
+// Package chain builds a chain of proof-of-work blocks, each committing to the hash of the block before it
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jaylees14/pow/worker/merkle"
+	"github.com/jaylees14/pow/worker/nonce"
+)
+
+// GenesisPrevHash is the previous hash of the first block, which has no block before it
+var GenesisPrevHash = strings.Repeat("0", 64)
+
+// Block is one block of a chain. Its nonce is appended to Contents, which commits to every other field.
+type Block struct {
+	Index uint64 `json:"index"`
+	// Timestamp is when mining the block started, in Unix milliseconds
+	Timestamp  int64        `json:"timestamp"`
+	Payload    string       `json:"payload,omitempty"`
+	PrevHash   string       `json:"prevHash"`
+	Target     nonce.Target `json:"target"`
+	Nonce      uint32       `json:"nonce"`
+	ExtraNonce uint32       `json:"extraNonce"`
+	Hash       string       `json:"hash"`
+	// Transactions, if any, replace the payload, and the block commits to their MerkleRoot rather than to them
+	// directly, so the contents mined stay small however many there are
+	Transactions []string `json:"transactions,omitempty"`
+	MerkleRoot   string   `json:"merkleRoot,omitempty"`
+}
+
+// Contents is what the block's nonce is appended to, index:timestamp:prevHash:target:payload, with the Merkle
+// root in place of the payload if the block holds transactions
+func (b *Block) Contents() string {
+	payload := b.Payload
+	if len(b.Transactions) > 0 {
+		payload = b.MerkleRoot
+	}
+	return fmt.Sprintf("%d:%d:%s:%s:%s", b.Index, b.Timestamp, b.PrevHash, b.Target, payload)
+}
+
+// Commit replaces the payload of an unmined block with transactions, committing to their Merkle root
+func (b *Block) Commit(transactions []string) error {
+	tree, err := b.merkleTree(transactions)
+	if err != nil {
+		return err
+	}
+	b.Payload = ""
+	b.Transactions = transactions
+	b.MerkleRoot = tree.Root().String()
+	return nil
+}
+
+// Tree builds the Merkle tree of the block's transactions, for checking its root or proving a transaction is in it
+func (b *Block) Tree() (*merkle.Tree, error) {
+	return b.merkleTree(b.Transactions)
+}
+
+func (b *Block) merkleTree(transactions []string) (*merkle.Tree, error) {
+	txs := make([][]byte, len(transactions))
+	for i, tx := range transactions {
+		txs[i] = []byte(tx)
+	}
+	return merkle.FromTransactions(txs)
+}
+
+// Time is when mining the block started
+func (b *Block) Time() time.Time {
+	return time.Unix(0, b.Timestamp*int64(time.Millisecond))
+}
+
+// Config is the search for the block's nonce, hashed with hasher
+func (b *Block) Config(hasher nonce.Hasher) *nonce.WorkerConfig {
+	return &nonce.WorkerConfig{
+		Contents:   b.Contents(),
+		UpperBound: nonce.NonceSpace,
+		Target:     b.Target,
+		ExtraNonce: b.ExtraNonce,
+		Hasher:     hasher,
+	}
+}
+
+// Solved fills in the nonce found for the block along with the hash it gives
+func (b *Block) Solved(gn *nonce.GoldenNonce, hasher nonce.Hasher) {
+	b.Nonce, b.ExtraNonce = gn.Nonce, gn.ExtraNonce
+	b.Hash, _ = nonce.VerifyConfig(b.Config(hasher), b.Nonce)
+}
+
+// Chain is a sequence of blocks mined with the same hashing algorithm, as stored in a chain file
+type Chain struct {
+	Algo       string `json:"algo"`
+	AlgoParams string `json:"algoParams,omitempty"`
+	// Retarget, if set, adjusts the target of every block after the first. Otherwise every block keeps the first
+	// block's target.
+	Retarget *Retarget `json:"retarget,omitempty"`
+	Blocks   []*Block  `json:"blocks"`
+	hasher   nonce.Hasher
+}
+
+// New returns an empty chain whose blocks are hashed with the given algorithm
+func New(algo string, algoParams string) (*Chain, error) {
+	hasher, err := nonce.NewHasher(algo, algoParams)
+	if err != nil {
+		return nil, err
+	}
+	return &Chain{Algo: algo, AlgoParams: algoParams, Blocks: []*Block{}, hasher: hasher}, nil
+}
+
+// Load reads the chain file at path. The blocks aren't checked.
+func Load(path string) (*Chain, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Chain{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("Invalid chain file %s: %s", path, err)
+	}
+	if c.hasher, err = nonce.NewHasher(c.Algo, c.AlgoParams); err != nil {
+		return nil, err
+	}
+	if c.Retarget != nil {
+		if err := c.Retarget.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Save writes the chain to path, replacing any existing file only once the new one is complete
+func (c *Chain) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(append(data, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Hasher is the hash function the chain's blocks are mined with
+func (c *Chain) Hasher() nonce.Hasher {
+	return c.hasher
+}
+
+// Tip is the last block of the chain, or nil if it is empty
+func (c *Chain) Tip() *Block {
+	if len(c.Blocks) == 0 {
+		return nil
+	}
+	return c.Blocks[len(c.Blocks)-1]
+}
+
+// Next returns an unmined block holding payload which extends the tip, dated now. Its target is the one the chain
+// retargets to, or else the first block's, so the given target only applies to the first block.
+func (c *Chain) Next(payload string, target nonce.Target, now time.Time) (*Block, error) {
+	if strings.Contains(payload, nonce.NoncePlaceholder) {
+		return nil, fmt.Errorf("Invalid payload, can't contain %s", nonce.NoncePlaceholder)
+	}
+
+	b := &Block{
+		Timestamp: now.UnixNano() / int64(time.Millisecond),
+		Payload:   payload,
+		PrevHash:  GenesisPrevHash,
+		Target:    target,
+	}
+	if tip := c.Tip(); tip != nil {
+		b.Index = tip.Index + 1
+		b.PrevHash = tip.Hash
+		if c.Retarget != nil {
+			b.Target = c.Retarget.Next(c.Blocks, b.Timestamp)
+		} else {
+			b.Target = c.Blocks[0].Target
+		}
+	}
+	return b, nil
+}
+
+// Append adds a mined block to the chain, checking it as Check does. Checking costs a single hash and rebuilding
+// the Merkle tree, so blocks mined elsewhere needn't be trusted.
+func (c *Chain) Append(b *Block) error {
+	c.Blocks = append(c.Blocks, b)
+	if err := c.Check(len(c.Blocks)-1, time.Now()); err != nil {
+		c.Blocks = c.Blocks[:len(c.Blocks)-1]
+		return err
+	}
+	return nil
+}
+
+// Mine searches for the nonce of b, from Next, on this machine, rolling the extra nonce until one is found or ctx is
+// done, and appends it to the chain
+func (c *Chain) Mine(ctx context.Context, b *Block) error {
+	for {
+		gn, err := nonce.CalculateGoldenNonceContext(ctx, b.Config(c.hasher))
+		if _, ok := err.(*nonce.NoNonceFoundError); ok {
+			b.ExtraNonce++
+			continue
+		} else if err != nil {
+			return err
+		}
+		b.Solved(gn, c.hasher)
+		return c.Append(b)
+	}
+}
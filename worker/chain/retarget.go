@@ -0,0 +1,128 @@
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/jaylees14/pow/worker/nonce"
+)
+
+// Algorithms for adjusting the target from the times blocks took
+const (
+	PeriodicRetarget string = "periodic"
+	LWMARetarget     string = "lwma"
+)
+
+const (
+	// maxAdjustment limits how far a periodic retarget moves the target, as Bitcoin does
+	maxAdjustment = 4
+	// maxSolveTimes limits how many intervals a single solve time counts for in LWMA, so one slow block can't
+	// make the next much easier
+	maxSolveTimes = 6
+)
+
+// maxTarget is the easiest target, which retargeting never goes beyond
+var maxTarget = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+// Retarget adjusts each block's target from the time the blocks before it took, compared to Interval.
+// The time a block took is from its timestamp to the next block's, as timestamps are when mining started.
+type Retarget struct {
+	Algorithm string `json:"algorithm"`
+	// Interval is how long each block should take, in milliseconds
+	Interval int64 `json:"interval"`
+	// Window is how many blocks apart periodic retargets are, or how many blocks LWMA averages over
+	Window int `json:"window"`
+}
+
+// Validate checks the retarget is one that Next can use
+func (r *Retarget) Validate() error {
+	if r.Algorithm != PeriodicRetarget && r.Algorithm != LWMARetarget {
+		return fmt.Errorf("Unknown retarget algorithm %q, must be periodic or lwma", r.Algorithm)
+	} else if r.Interval <= 0 {
+		return errors.New("Invalid retarget interval, must be greater than 0")
+	} else if r.Window <= 0 {
+		return errors.New("Invalid retarget window, must be greater than 0")
+	}
+	return nil
+}
+
+// Next is the target of the block after blocks, which are the whole chain so far, dated timestamp. An empty chain
+// has no target to adjust, so the first block's is chosen by the miner.
+func (r *Retarget) Next(blocks []*Block, timestamp int64) nonce.Target {
+	if len(blocks) == 0 {
+		return nonce.Target{}
+	}
+	if r.Algorithm == LWMARetarget {
+		return r.lwma(blocks, timestamp)
+	}
+	return r.periodic(blocks, timestamp)
+}
+
+// periodic keeps the target for Window blocks, then scales it by how long they took compared to how long they
+// should have, clamped to a factor of 4 either way
+func (r *Retarget) periodic(blocks []*Block, timestamp int64) nonce.Target {
+	tip := blocks[len(blocks)-1]
+	height := len(blocks)
+	if height%r.Window != 0 {
+		return tip.Target
+	}
+
+	expected := r.Interval * int64(r.Window)
+	actual := timestamp - blocks[height-r.Window].Timestamp
+	if actual < expected/maxAdjustment {
+		actual = expected / maxAdjustment
+	} else if actual > expected*maxAdjustment {
+		actual = expected * maxAdjustment
+	}
+
+	t := new(big.Int).SetBytes(tip.Target[:])
+	t.Mul(t, big.NewInt(actual))
+	t.Quo(t, big.NewInt(expected))
+	return toTarget(t)
+}
+
+// lwma is Zawy's linearly weighted moving average, recomputing the target for every block from the last Window
+// solve times, weighting the most recent the most so the target responds quickly to changes in hash rate
+func (r *Retarget) lwma(blocks []*Block, timestamp int64) nonce.Target {
+	n := r.Window
+	if n > len(blocks) {
+		n = len(blocks)
+	}
+	recent := blocks[len(blocks)-n:]
+
+	sumTargets := new(big.Int)
+	weighted := int64(0)
+	for i, b := range recent {
+		next := timestamp
+		if i+1 < len(recent) {
+			next = recent[i+1].Timestamp
+		}
+		solveTime := next - b.Timestamp
+		if solveTime < 1 {
+			solveTime = 1
+		} else if solveTime > maxSolveTimes*r.Interval {
+			solveTime = maxSolveTimes * r.Interval
+		}
+		weighted += int64(i+1) * solveTime
+		sumTargets.Add(sumTargets, new(big.Int).SetBytes(b.Target[:]))
+	}
+
+	// The average target, scaled by the weighted solve time over what it would be if every block took Interval
+	t := sumTargets.Mul(sumTargets, big.NewInt(weighted))
+	t.Quo(t, big.NewInt(int64(n)*r.Interval*int64(n)*int64(n+1)/2))
+	return toTarget(t)
+}
+
+// toTarget converts t to a Target, keeping it between 1 and the easiest target
+func toTarget(t *big.Int) nonce.Target {
+	if t.Cmp(maxTarget) > 0 {
+		t = maxTarget
+	} else if t.Sign() <= 0 {
+		t = big.NewInt(1)
+	}
+
+	var target nonce.Target
+	t.FillBytes(target[:])
+	return target
+}
@@ -0,0 +1,147 @@
+package chain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/jaylees14/pow/worker/nonce"
+)
+
+// testTarget is comfortably below the easiest target, so it can be made 4 times easier
+var testTarget = nonce.TargetFromCompact(0x1d00ffff)
+
+// blocksTaking returns blocks with target, the first dated start and each after it solveTimes later, along with
+// when the last of them finished, in milliseconds
+func blocksTaking(target nonce.Target, start int64, solveTimes ...int64) ([]*Block, int64) {
+	blocks := []*Block{}
+	timestamp := start
+	for i, solveTime := range solveTimes {
+		blocks = append(blocks, &Block{Index: uint64(i), Timestamp: timestamp, Target: target})
+		timestamp += solveTime
+	}
+	return blocks, timestamp
+}
+
+// repeat returns n copies of solveTime
+func repeat(n int, solveTime int64) []int64 {
+	times := make([]int64, n)
+	for i := range times {
+		times[i] = solveTime
+	}
+	return times
+}
+
+// scaled returns target multiplied by num/den, as big integers so the expected value is exact
+func scaled(target nonce.Target, num int64, den int64) nonce.Target {
+	t := new(big.Int).SetBytes(target[:])
+	t.Mul(t, big.NewInt(num))
+	t.Quo(t, big.NewInt(den))
+	return toTarget(t)
+}
+
+func TestPeriodicRetarget(t *testing.T) {
+	r := &Retarget{Algorithm: PeriodicRetarget, Interval: 1000, Window: 10}
+	tests := []struct {
+		name      string
+		solveTime int64
+		blocks    int
+		target    nonce.Target
+	}{
+		{"on time", 1000, 10, testTarget},
+		{"twice as slow", 2000, 10, scaled(testTarget, 2, 1)},
+		{"twice as fast", 500, 10, scaled(testTarget, 1, 2)},
+		{"just within the clamp", 4000, 10, scaled(testTarget, 4, 1)},
+		{"slower than the clamp", 10000, 10, scaled(testTarget, 4, 1)},
+		{"faster than the clamp", 100, 10, scaled(testTarget, 1, 4)},
+		{"instant", 0, 10, scaled(testTarget, 1, 4)},
+		{"between retargets", 10000, 9, testTarget},
+		{"second period", 2000, 20, scaled(testTarget, 2, 1)},
+	}
+	for _, test := range tests {
+		blocks, timestamp := blocksTaking(testTarget, 1000000, repeat(test.blocks, test.solveTime)...)
+		if got := r.Next(blocks, timestamp); got != test.target {
+			t.Errorf("%s: target = %s, want %s", test.name, got, test.target)
+		}
+	}
+}
+
+func TestPeriodicRetargetEasiest(t *testing.T) {
+	r := &Retarget{Algorithm: PeriodicRetarget, Interval: 1000, Window: 4}
+	easy := nonce.TargetFromLeadingZeros(1)
+	blocks, timestamp := blocksTaking(easy, 0, repeat(4, 4000)...)
+	want := toTarget(maxTarget)
+	if got := r.Next(blocks, timestamp); got != want {
+		t.Errorf("Target = %s, want it capped at %s", got, want)
+	}
+}
+
+// TestBitcoinRetarget replays the first difficulty change of Bitcoin, at block 32256. Its 2016 blocks took
+// 1022578 seconds rather than two weeks, from block 30240's timestamp to block 32255's, which the first and next
+// timestamps of a Window stand in for here.
+func TestBitcoinRetarget(t *testing.T) {
+	r := &Retarget{Algorithm: PeriodicRetarget, Interval: 600 * 1000, Window: 2016}
+	blocks := make([]*Block, 2016)
+	for i := range blocks {
+		blocks[i] = &Block{Index: uint64(i), Target: nonce.TargetFromCompact(0x1d00ffff)}
+	}
+	blocks[0].Timestamp = 1261130161 * 1000
+
+	got := r.Next(blocks, 1262152739*1000)
+	if got.Compact() != 0x1d00d86a {
+		t.Errorf("Target = %s (bits %08x), want bits 1d00d86a", got, got.Compact())
+	}
+}
+
+func TestLWMARetarget(t *testing.T) {
+	r := &Retarget{Algorithm: LWMARetarget, Interval: 1000, Window: 10}
+	tests := []struct {
+		name       string
+		solveTimes []int64
+		target     nonce.Target
+	}{
+		{"steady state", repeat(10, 1000), testTarget},
+		{"steady state, longer chain", repeat(25, 1000), testTarget},
+		{"steady state, shorter chain", repeat(3, 1000), testTarget},
+		{"twice as slow", repeat(10, 2000), scaled(testTarget, 2, 1)},
+		{"twice as fast", repeat(10, 500), scaled(testTarget, 1, 2)},
+		{"solve times capped", repeat(10, 100000), scaled(testTarget, maxSolveTimes, 1)},
+		{"solve times at least 1ms", repeat(10, 0), scaled(testTarget, 1, 1000)},
+		// Only the most recent block was slow, weighted 10 out of 55
+		{"one slow block", append(repeat(9, 1000), 2000), scaled(testTarget, 55+10, 55)},
+		// The first was slow, weighted 1 out of 55, so the target moves far less
+		{"one old slow block", append([]int64{2000}, repeat(9, 1000)...), scaled(testTarget, 55+1, 55)},
+	}
+	for _, test := range tests {
+		blocks, timestamp := blocksTaking(testTarget, 1000000, test.solveTimes...)
+		if got := r.Next(blocks, timestamp); got != test.target {
+			t.Errorf("%s: target = %s, want %s", test.name, got, test.target)
+		}
+	}
+}
+
+func TestRetargetEmptyChain(t *testing.T) {
+	for _, algorithm := range []string{PeriodicRetarget, LWMARetarget} {
+		r := &Retarget{Algorithm: algorithm, Interval: 1000, Window: 10}
+		if got := r.Next(nil, 1000); !got.IsZero() {
+			t.Errorf("%s: target of the first block = %s, want zero for the miner to choose", algorithm, got)
+		}
+	}
+}
+
+func TestRetargetValidate(t *testing.T) {
+	tests := []struct {
+		retarget Retarget
+		valid    bool
+	}{
+		{Retarget{PeriodicRetarget, 1000, 10}, true},
+		{Retarget{LWMARetarget, 1, 1}, true},
+		{Retarget{"bitcoin", 1000, 10}, false},
+		{Retarget{PeriodicRetarget, 0, 10}, false},
+		{Retarget{LWMARetarget, 1000, 0}, false},
+	}
+	for _, test := range tests {
+		if err := test.retarget.Validate(); (err == nil) != test.valid {
+			t.Errorf("Validate(%+v) = %v, want valid %t", test.retarget, err, test.valid)
+		}
+	}
+}
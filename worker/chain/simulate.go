@@ -0,0 +1,50 @@
+package chain
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/jaylees14/pow/worker/nonce"
+)
+
+// SimulatedBlock is a block mined by a Simulation, which has no nonce or hash
+type SimulatedBlock struct {
+	*Block
+	// Workers is how many workers mined the block, and SolveTime how long they took
+	Workers   int
+	SolveTime time.Duration
+}
+
+// Simulation mines a chain statistically rather than by hashing, to show how retargeting responds to workers being
+// added and removed. The time each block takes is drawn from the exponential distribution given by its target and
+// the combined hash rate of the workers.
+type Simulation struct {
+	Retarget *Retarget
+	// Initial is the target of the first block, and of every block if Retarget is nil
+	Initial nonce.Target
+	// HashRate is how many hashes a second each worker computes
+	HashRate float64
+	// Workers gives how many workers mine the block at each height
+	Workers func(height int) int
+	Rand    *rand.Rand
+}
+
+// Run simulates mining the given number of blocks, starting from the Unix epoch
+func (s *Simulation) Run(blocks int) []SimulatedBlock {
+	c := &Chain{Retarget: s.Retarget}
+	simulated := make([]SimulatedBlock, 0, blocks)
+	now := time.Unix(0, 0)
+	for height := 0; height < blocks; height++ {
+		b, _ := c.Next("", s.Initial, now)
+		workers := s.Workers(height)
+
+		mean := 1 / (b.Target.Probability() * s.HashRate * float64(workers))
+		solveTime := time.Duration(math.Min(s.Rand.ExpFloat64()*mean, math.MaxInt64/1e9) * float64(time.Second))
+		now = now.Add(solveTime)
+
+		c.Blocks = append(c.Blocks, b)
+		simulated = append(simulated, SimulatedBlock{Block: b, Workers: workers, SolveTime: solveTime})
+	}
+	return simulated
+}
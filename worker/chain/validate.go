@@ -0,0 +1,86 @@
+package chain
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/jaylees14/pow/worker/nonce"
+)
+
+// maxFutureTime is how far past now a block may be dated, allowing for clocks being out, as Bitcoin allows
+const maxFutureTime = 2 * time.Hour
+
+// LoadBlock reads a file holding a single block, such as one copied out of a chain file. The block isn't checked.
+func LoadBlock(path string) (*Block, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Block{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("Invalid block file %s: %s", path, err)
+	}
+	return b, nil
+}
+
+// Check verifies everything the block commits to on its own: the Merkle root of its transactions, that it isn't
+// dated in the future, and that its nonce gives its hash, which meets its target
+func (b *Block) Check(hasher nonce.Hasher, now time.Time) error {
+	if strings.Contains(b.Payload, nonce.NoncePlaceholder) {
+		return fmt.Errorf("Invalid block %d, its payload can't contain %s", b.Index, nonce.NoncePlaceholder)
+	}
+	if len(b.Transactions) > 0 {
+		tree, err := b.Tree()
+		if err != nil {
+			return err
+		} else if root := tree.Root().String(); root != b.MerkleRoot {
+			return fmt.Errorf("Invalid block %d, the merkle root of its transactions is %s rather than %s", b.Index, root, b.MerkleRoot)
+		}
+	} else if len(b.MerkleRoot) > 0 {
+		return fmt.Errorf("Invalid block %d, it has a merkle root but no transactions", b.Index)
+	}
+	if b.Time().After(now.Add(maxFutureTime)) {
+		return fmt.Errorf("Invalid block %d, its timestamp %s is in the future", b.Index, b.Time().UTC().Format(time.RFC3339))
+	}
+
+	hash, ok := nonce.VerifyConfig(b.Config(hasher), b.Nonce)
+	if hash != b.Hash {
+		return fmt.Errorf("Invalid block %d, its hash is %s rather than %s", b.Index, hash, b.Hash)
+	} else if !ok {
+		return fmt.Errorf("Invalid block %d, its hash %s doesn't meet its target", b.Index, hash)
+	}
+	return nil
+}
+
+// Check verifies block i of the chain, assuming the blocks before it are valid. As well as Block.Check, it must
+// extend block i-1, not be dated before it, and have the target the chain retargets to, or block 0's if it doesn't
+// retarget.
+func (c *Chain) Check(i int, now time.Time) error {
+	b := c.Blocks[i]
+	prevHash := GenesisPrevHash
+	if i > 0 {
+		prev := c.Blocks[i-1]
+		prevHash = prev.Hash
+		if b.Timestamp < prev.Timestamp {
+			return fmt.Errorf("Invalid block %d, it is dated before block %d", b.Index, prev.Index)
+		}
+		if c.Retarget != nil {
+			if target := c.Retarget.Next(c.Blocks[:i], b.Timestamp); b.Target != target {
+				return fmt.Errorf("Invalid block %d, its target is %s rather than %s", b.Index, b.Target, target)
+			}
+		} else if target := c.Blocks[0].Target; b.Target != target {
+			return fmt.Errorf("Invalid block %d, its target is %s rather than block 0's %s, as the chain doesn't retarget", b.Index, b.Target, target)
+		}
+	}
+
+	if b.Index != uint64(i) {
+		return fmt.Errorf("Invalid block at height %d, its index is %d", i, b.Index)
+	} else if b.PrevHash != prevHash {
+		return fmt.Errorf("Invalid block %d, its previous hash is %s rather than %s", b.Index, b.PrevHash, prevHash)
+	}
+	return b.Check(c.hasher, now)
+}
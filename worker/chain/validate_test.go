@@ -0,0 +1,51 @@
+package chain
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaylees14/pow/worker/nonce"
+)
+
+// mineBlock solves b on this machine without appending it, so blocks the chain would reject can be built
+func mineBlock(t *testing.T, c *Chain, b *Block) {
+	t.Helper()
+	gn, err := nonce.CalculateGoldenNonceContext(context.Background(), b.Config(c.Hasher()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Solved(gn, c.Hasher())
+}
+
+func TestCheckFixedTarget(t *testing.T) {
+	c, err := New(nonce.SHA256D, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := nonce.TargetFromLeadingZeros(4)
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		// Without retargeting, only the first block takes the given target
+		b, err := c.Next("block", nonce.TargetFromLeadingZeros(4+i), now)
+		if err != nil {
+			t.Fatal(err)
+		} else if b.Target != target {
+			t.Errorf("Next block %d has target %s, want the first block's %s", i, b.Target, target)
+		}
+		if err := c.Mine(context.Background(), b); err != nil {
+			t.Fatalf("Mine block %d: %v", i, err)
+		}
+	}
+
+	b, _ := c.Next("block", target, now)
+	b.Target = nonce.TargetFromLeadingZeros(2)
+	mineBlock(t, c, b)
+	if err := c.Append(b); err == nil || !strings.Contains(err.Error(), "rather than block 0's") {
+		t.Errorf("Append of a block with an easier target = %v, want it rejected", err)
+	}
+	if len(c.Blocks) != 2 {
+		t.Errorf("Chain has %d blocks after a rejected append, want 2", len(c.Blocks))
+	}
+}
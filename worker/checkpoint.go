@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/jaylees14/pow/worker/nonce"
+)
+
+const (
+	checkpointPath string = "checkpoint.json"
+	// Time between progress reports, which checkpoint the search, whatever the hasher's cost
+	progressPeriod = 5 * time.Second
+)
+
+// checkpoint is saved as the search progresses so a restarted worker can resume its job
+type checkpoint struct {
+	JobID  string        `json:"jobId"`
+	Cursor *nonce.Cursor `json:"cursor"`
+}
+
+// loadCheckpoint returns the saved cursor for the given job, or nil if there isn't one
+func loadCheckpoint(jobID string) *nonce.Cursor {
+	data, err := ioutil.ReadFile(checkpointPath)
+	if err != nil {
+		return nil
+	}
+
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil || cp.JobID != jobID {
+		return nil
+	}
+	return cp.Cursor
+}
+
+func saveCheckpoint(jobID string, cursor *nonce.Cursor) error {
+	data, err := json.Marshal(checkpoint{jobID, cursor})
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash can't leave a corrupt checkpoint
+	tmpPath := checkpointPath + ".tmp"
+	err = ioutil.WriteFile(tmpPath, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, checkpointPath)
+}
+
+func clearCheckpoint() {
+	os.Remove(checkpointPath)
+}
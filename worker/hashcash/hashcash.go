@@ -0,0 +1,170 @@
+// Package hashcash mints and verifies hashcash version 1 stamps using the nonce search
+package hashcash
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jaylees14/pow/worker/nonce"
+)
+
+// Version is the only stamp format supported
+const Version = 1
+
+// dateFormat is used when minting, though stamps dated to the day or the minute are also accepted
+const dateFormat = "060102150405"
+
+// MaxBits is the most bits a stamp can be minted with. Each 32-bit counter space holds a stamp of 32 bits on
+// average, so beyond that Mint re-randomises 2^(bits-32) times on average, and 40 bits already takes 256.
+const MaxBits = 40
+
+// randBytes is the amount of randomness in each stamp, so that stamps minted for the same resource differ
+const randBytes = 12
+
+// hasher is the SHA-1 digest hashcash is defined with
+var hasher, _ = nonce.NewHasher(nonce.SHA1, "")
+
+// counterEncoding writes the counter as hex, which is a subset of the base64 characters hashcash allows
+var counterEncoding = nonce.Encoding{Format: nonce.Hex}
+
+// Stamp is a hashcash version 1 stamp, 1:bits:date:resource:ext:rand:counter
+type Stamp struct {
+	Bits     int
+	Date     time.Time
+	Resource string
+	Ext      string
+	Rand     string
+	Counter  string
+	// dateLayout keeps the precision of a parsed date, so the stamp formats exactly as it was given
+	dateLayout string
+}
+
+// NewStamp returns an unminted stamp for resource with fresh randomness, dated now
+func NewStamp(resource string, bits int, ext string) (*Stamp, error) {
+	if strings.Contains(resource, ":") || strings.Contains(ext, ":") {
+		return nil, errors.New("Invalid stamp, resource and extension can't contain ':'")
+	} else if bits <= 0 || bits > MaxBits {
+		return nil, fmt.Errorf("Invalid stamp bits, must be in range (0, %d]", MaxBits)
+	}
+
+	random := make([]byte, randBytes)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+
+	return &Stamp{
+		Bits:     bits,
+		Date:     time.Now().UTC(),
+		Resource: resource,
+		Ext:      ext,
+		Rand:     base64.StdEncoding.EncodeToString(random),
+	}, nil
+}
+
+// ParseStamp reads a stamp in its string form
+func ParseStamp(s string) (*Stamp, error) {
+	fields := strings.Split(s, ":")
+	if len(fields) != 7 {
+		return nil, fmt.Errorf("Invalid stamp %q, must have 7 fields", s)
+	} else if fields[0] != strconv.Itoa(Version) {
+		return nil, fmt.Errorf("Unsupported stamp version %s, must be %d", fields[0], Version)
+	}
+
+	stampBits, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid stamp bits %s", fields[1])
+	}
+
+	// Dates are YYMMDD, YYMMDDhhmm or YYMMDDhhmmss in UTC
+	dateErr := fmt.Errorf("Invalid stamp date %s, must be YYMMDD[hhmm[ss]]", fields[2])
+	if n := len(fields[2]); n != 6 && n != 10 && n != 12 {
+		return nil, dateErr
+	}
+	dateLayout := dateFormat[:len(fields[2])]
+	date, err := time.Parse(dateLayout, fields[2])
+	if err != nil {
+		return nil, dateErr
+	}
+
+	return &Stamp{
+		Bits:       stampBits,
+		Date:       date,
+		Resource:   fields[3],
+		Ext:        fields[4],
+		Rand:       fields[5],
+		Counter:    fields[6],
+		dateLayout: dateLayout,
+	}, nil
+}
+
+// String formats the stamp as it is hashed and sent
+func (s *Stamp) String() string {
+	return s.withCounter(s.Counter)
+}
+
+func (s *Stamp) withCounter(counter string) string {
+	layout := s.dateLayout
+	if len(layout) == 0 {
+		layout = dateFormat
+	}
+	return fmt.Sprintf("%d:%d:%s:%s:%s:%s:%s", Version, s.Bits, s.Date.Format(layout), s.Resource, s.Ext, s.Rand, counter)
+}
+
+// Config returns the nonce search which mints the stamp, with the counter as a hex nonce.
+// Its digest is SHA-1, compared against a target of the stamp's bits.
+func (s *Stamp) Config() *nonce.WorkerConfig {
+	return &nonce.WorkerConfig{
+		Contents:   s.withCounter(nonce.NoncePlaceholder),
+		UpperBound: nonce.NonceSpace,
+		Target:     nonce.TargetFromLeadingZeros(s.Bits),
+		Hasher:     hasher,
+		Encoding:   counterEncoding,
+	}
+}
+
+// Solved sets the counter from a golden nonce found by searching the stamp's Config
+func (s *Stamp) Solved(gn *nonce.GoldenNonce) {
+	config := s.Config()
+	config.ExtraNonce = gn.ExtraNonce
+	payload := string(nonce.Payload(config, gn.Nonce))
+	s.Counter = payload[strings.LastIndex(payload, ":")+1:]
+}
+
+// LeadingZeros counts the leading zero bits of the stamp's SHA-1 digest, which is the value it actually has
+func (s *Stamp) LeadingZeros() int {
+	sum := sha1.Sum([]byte(s.String()))
+	for i, b := range sum {
+		if b != 0 {
+			return i*8 + bits.LeadingZeros8(b)
+		}
+	}
+	return len(sum) * 8
+}
+
+// Mint searches for a stamp for resource with the given number of bits, using every CPU of this machine.
+// If the 32-bit counter space runs out the stamp is re-randomised and the search starts again.
+func Mint(ctx context.Context, resource string, bits int, ext string) (*Stamp, error) {
+	for {
+		stamp, err := NewStamp(resource, bits, ext)
+		if err != nil {
+			return nil, err
+		}
+
+		gn, err := nonce.CalculateGoldenNonceContext(ctx, stamp.Config())
+		if _, ok := err.(*nonce.NoNonceFoundError); ok {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		stamp.Solved(gn)
+		return stamp, nil
+	}
+}
@@ -0,0 +1,195 @@
+package hashcash
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaylees14/pow/worker/nonce"
+)
+
+const (
+	testResource = "alice@example.com"
+	testBits     = 12
+)
+
+// mint mints a stamp for testResource, failing the test if it can't
+func mint(t *testing.T) *Stamp {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	stamp, err := Mint(ctx, testResource, testBits, "")
+	if err != nil {
+		t.Fatalf("Mint: %v", err)
+	}
+	return stamp
+}
+
+func TestMintVerify(t *testing.T) {
+	stamp := mint(t)
+	if zeros := stamp.LeadingZeros(); zeros < testBits {
+		t.Fatalf("Minted stamp %s has %d leading zeros, want at least %d", stamp, zeros, testBits)
+	}
+
+	parsed, err := ParseStamp(stamp.String())
+	if err != nil || parsed.String() != stamp.String() {
+		t.Fatalf("ParseStamp(%s) = %v, %v", stamp, parsed, err)
+	}
+
+	verifier := &Verifier{Bits: testBits}
+	if _, err := verifier.Verify(stamp.String(), testResource); err != nil {
+		t.Errorf("Verify(%s) = %v", stamp, err)
+	}
+}
+
+func TestSolvedWithExtraNonce(t *testing.T) {
+	stamp, err := NewStamp(testResource, testBits, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := stamp.Config()
+	config.ExtraNonce = 7
+	gn, err := nonce.CalculateGoldenNonce(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stamp.Solved(gn)
+	if zeros := stamp.LeadingZeros(); zeros < testBits {
+		t.Errorf("Stamp %s solved with extra nonce 7 has %d leading zeros, want at least %d", stamp, zeros, testBits)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	stamp := mint(t)
+	tests := []struct {
+		name     string
+		stamp    string
+		resource string
+		verifier *Verifier
+		err      string
+	}{
+		{"wrong resource", stamp.String(), "bob@example.com", &Verifier{Bits: testBits}, "rather than bob@example.com"},
+		{"too few bits claimed", stamp.String(), testResource, &Verifier{Bits: testBits + 1}, "are required"},
+		{"bits claimed but not had", strings.Replace(stamp.String(), "1:12:", "1:40:", 1), testResource, &Verifier{Bits: testBits}, "but only has"},
+		{"expired", stamp.String(), testResource, &Verifier{Bits: testBits, Now: func() time.Time {
+			return stamp.Date.Add(DefaultMaxAge + time.Minute)
+		}}, "expired"},
+		{"expired sooner", stamp.String(), testResource, &Verifier{Bits: testBits, MaxAge: time.Hour, Now: func() time.Time {
+			return stamp.Date.Add(2 * time.Hour)
+		}}, "expired"},
+		{"future", stamp.String(), testResource, &Verifier{Bits: testBits, Now: func() time.Time {
+			return stamp.Date.Add(-time.Hour)
+		}}, "in the future"},
+		{"malformed", "1:12:abc", testResource, &Verifier{Bits: testBits}, "must have 7 fields"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := test.verifier.Verify(test.stamp, test.resource)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Verify(%s, %s) = %v, want an error containing %q", test.stamp, test.resource, err, test.err)
+			}
+		})
+	}
+}
+
+func TestVerifyReplay(t *testing.T) {
+	stamp := mint(t)
+	verifier := &Verifier{Bits: testBits, Store: NewMemoryStore()}
+	if _, err := verifier.Verify(stamp.String(), testResource); err != nil {
+		t.Fatalf("First Verify(%s) = %v", stamp, err)
+	}
+	if _, err := verifier.Verify(stamp.String(), testResource); err == nil || !strings.Contains(err.Error(), "already been spent") {
+		t.Errorf("Second Verify(%s) = %v, want it rejected as spent", stamp, err)
+	}
+
+	// Another stamp is still accepted
+	other := mint(t)
+	if _, err := verifier.Verify(other.String(), testResource); err != nil {
+		t.Errorf("Verify(%s) after spending another stamp = %v", other, err)
+	}
+}
+
+func TestFileStoreReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hashcash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "seen")
+
+	stamp := mint(t)
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := &Verifier{Bits: testBits, Store: store}
+	_, err = verifier.Verify(stamp.String(), testResource)
+	store.Close()
+	if err != nil {
+		t.Fatalf("Verify(%s) = %v", stamp, err)
+	}
+
+	// The spent stamp survives reopening the store
+	store, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	verifier.Store = store
+	if _, err := verifier.Verify(stamp.String(), testResource); err == nil || !strings.Contains(err.Error(), "already been spent") {
+		t.Errorf("Verify(%s) after reopening the store = %v, want it rejected as spent", stamp, err)
+	}
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	if !store.add("stamp", now.Add(time.Minute), now) {
+		t.Fatal("First add was rejected")
+	}
+	if store.add("stamp", now.Add(time.Minute), now.Add(time.Second)) {
+		t.Error("Add before expiry was accepted")
+	}
+	if !store.add("stamp", now.Add(time.Hour), now.Add(2*time.Minute)) {
+		t.Error("Add after expiry was rejected")
+	}
+}
+
+func TestNewStampBits(t *testing.T) {
+	for _, bits := range []int{-1, 0, MaxBits + 1, 160} {
+		if _, err := NewStamp(testResource, bits, ""); err == nil {
+			t.Errorf("NewStamp with %d bits succeeded, want an error", bits)
+		}
+	}
+	if _, err := NewStamp(testResource, MaxBits, ""); err != nil {
+		t.Errorf("NewStamp with %d bits: %v", MaxBits, err)
+	}
+}
+
+func TestFileStoreFailedWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hashcash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := OpenFileStore(filepath.Join(dir, "seen"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// With the file closed the write fails, and the stamp mustn't be left spent in memory alone
+	expiry := time.Now().Add(time.Hour)
+	if _, err := store.Add("stamp", expiry); err == nil {
+		t.Fatal("Add with the file closed succeeded, want an error")
+	}
+	if _, ok := store.seen["stamp"]; ok {
+		t.Error("Stamp is marked as spent after its write failed")
+	}
+}
@@ -0,0 +1,113 @@
+package hashcash
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how many stamps are added to a MemoryStore between removals of expired ones
+const pruneInterval = 1024
+
+// SeenStore records which stamps have been spent, so that each can only be used once
+type SeenStore interface {
+	// Add marks stamp as spent until expiry, reporting false if it had already been spent
+	Add(stamp string, expiry time.Time) (bool, error)
+}
+
+// MemoryStore is a SeenStore held in memory, and safe for concurrent use
+type MemoryStore struct {
+	mu    sync.Mutex
+	seen  map[string]time.Time
+	added int
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{seen: make(map[string]time.Time)}
+}
+
+// Add implements SeenStore
+func (m *MemoryStore) Add(stamp string, expiry time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.add(stamp, expiry, time.Now()), nil
+}
+
+func (m *MemoryStore) add(stamp string, expiry time.Time, now time.Time) bool {
+	if e, ok := m.seen[stamp]; ok && now.Before(e) {
+		return false
+	}
+	m.seen[stamp] = expiry
+
+	m.added++
+	if m.added%pruneInterval == 0 {
+		for s, e := range m.seen {
+			if now.After(e) {
+				delete(m.seen, s)
+			}
+		}
+	}
+	return true
+}
+
+// FileStore is a MemoryStore which also appends each spent stamp to a file, so that it survives restarts
+type FileStore struct {
+	MemoryStore
+	file *os.File
+}
+
+// OpenFileStore loads the unexpired stamps spent in the file at path, creating it if it doesn't exist
+func OpenFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &FileStore{MemoryStore: MemoryStore{seen: make(map[string]time.Time)}, file: file}
+	now := time.Now()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Each line is the expiry as a unix time followed by the stamp
+		fields := strings.SplitN(scanner.Text(), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		store.add(fields[1], time.Unix(expiry, 0), now)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Add implements SeenStore
+func (f *FileStore) Add(stamp string, expiry time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if e, ok := f.seen[stamp]; ok && now.Before(e) {
+		return false, nil
+	}
+	// Write before marking the stamp as spent, so a failed write leaves it unspent to be presented again rather than
+	// spent only until a restart
+	if _, err := fmt.Fprintf(f.file, "%d %s\n", expiry.Unix(), stamp); err != nil {
+		return false, err
+	}
+	return f.add(stamp, expiry, now), nil
+}
+
+// Close closes the underlying file
+func (f *FileStore) Close() error {
+	return f.file.Close()
+}
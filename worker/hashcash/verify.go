@@ -0,0 +1,65 @@
+package hashcash
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultMaxAge is how old a stamp may be before it is rejected, if the Verifier doesn't set one
+	DefaultMaxAge = 48 * time.Hour
+	// clockSkew is how far in the future a stamp may be dated, allowing for the minter's clock being ahead
+	clockSkew = 5 * time.Minute
+)
+
+// Verifier checks stamps presented for a resource, rejecting any which have been spent before
+type Verifier struct {
+	// Bits is the least number of bits a stamp must claim and have
+	Bits int
+	// MaxAge is how old a stamp may be, defaulting to DefaultMaxAge
+	MaxAge time.Duration
+	// Store records spent stamps. Double spending isn't checked if it is nil.
+	Store SeenStore
+	// Now returns the current time, defaulting to time.Now
+	Now func() time.Time
+}
+
+// Verify checks that stamp is a fresh, unspent stamp for resource with enough bits, and marks it as spent
+func (v *Verifier) Verify(stamp string, resource string) (*Stamp, error) {
+	s, err := ParseStamp(stamp)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	maxAge := v.MaxAge
+	if maxAge == 0 {
+		maxAge = DefaultMaxAge
+	}
+
+	if s.Resource != resource {
+		return nil, fmt.Errorf("Invalid stamp, it is for resource %s rather than %s", s.Resource, resource)
+	} else if s.Bits < v.Bits {
+		return nil, fmt.Errorf("Invalid stamp, it claims %d bits but %d are required", s.Bits, v.Bits)
+	} else if zeros := s.LeadingZeros(); zeros < s.Bits {
+		return nil, fmt.Errorf("Invalid stamp, it claims %d bits but only has %d", s.Bits, zeros)
+	} else if s.Date.After(now.Add(clockSkew)) {
+		return nil, fmt.Errorf("Invalid stamp, it is dated in the future at %s", s.Date.Format(time.RFC3339))
+	} else if expiry := s.Date.Add(maxAge); now.After(expiry) {
+		return nil, fmt.Errorf("Invalid stamp, it expired at %s", expiry.Format(time.RFC3339))
+	}
+
+	if v.Store != nil {
+		// Once expired the stamp is rejected anyway, so the store only has to remember it until then
+		fresh, err := v.Store.Add(stamp, s.Date.Add(maxAge))
+		if err != nil {
+			return nil, err
+		} else if !fresh {
+			return nil, fmt.Errorf("Invalid stamp, it has already been spent")
+		}
+	}
+	return s, nil
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -15,6 +21,16 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+const (
+	// enumerationChunkSize is how many nonces are sent per message, keeping well within the SQS limit of 256 KiB
+	enumerationChunkSize = 1000
+	// visibilityGrace is how long past its timeout a job's message stays hidden, so it isn't handed to another
+	// worker while this one is still searching or reporting
+	visibilityGrace = time.Minute
+	// maxVisibilityTimeout is the longest SQS will hide a message for
+	maxVisibilityTimeout = 12 * time.Hour
+)
+
 func checkError(err error, message string) {
 	if err != nil {
 		log.Fatal(fmt.Sprintf("[%s]: %s", message, err.Error()))
@@ -22,6 +38,14 @@ func checkError(err error, message string) {
 	}
 }
 
+// logError logs err, if there is one, for errors which only affect the current job, so the worker carries on with
+// the next
+func logError(err error, message string) {
+	if err != nil {
+		log.Printf("[%s]: %s", message, err.Error())
+	}
+}
+
 func getMessageFromQueue(session *session.Session, queueName string) (*sqs.ReceiveMessageOutput, error) {
 	// Create a SQS service client.
 	svc := sqs.New(session)
@@ -43,25 +67,50 @@ func getMessageFromQueue(session *session.Session, queueName string) (*sqs.Recei
 			"All",
 		}),
 		WaitTimeSeconds: aws.Int64(10),
-		// Allow a maximum of 5 minutes for this request to be processed
+		// Allow 5 minutes to decode the job, when the message is hidden for as long as its timeout instead
 		VisibilityTimeout: aws.Int64(5 * 60),
 	})
 }
 
-func decodeWorkerMessage(message *sqs.Message) (*nonce.WorkerConfig, error) {
-	lowerBoundStr, ok := message.MessageAttributes["LowerBound"]
-	if !ok {
-		return nil, errors.New("Message didn't contain key LowerBound")
+// changeMessageVisibility hides message from other workers for the given time from now, or makes it available to
+// them straight away if it is 0
+func changeMessageVisibility(session *session.Session, queueName string, message *sqs.Message, timeout time.Duration) error {
+	svc := sqs.New(session)
+
+	// Get QueueURL
+	resultURL, err := svc.GetQueueUrl(&sqs.GetQueueUrlInput{
+		QueueName: aws.String(queueName),
+	})
+	if err != nil {
+		return err
 	}
 
-	upperBoundStr, ok := message.MessageAttributes["UpperBound"]
-	if !ok {
-		return nil, errors.New("Message didn't contain key UpperBound")
+	if timeout > maxVisibilityTimeout {
+		timeout = maxVisibilityTimeout
 	}
+	_, err = svc.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          resultURL.QueueUrl,
+		ReceiptHandle:     message.ReceiptHandle,
+		VisibilityTimeout: aws.Int64(int64(timeout / time.Second)),
+	})
+	return err
+}
+
+// job is a partition of the search decoded from the input queue
+type job struct {
+	config  *nonce.WorkerConfig
+	timeout time.Duration
+	// searchID is echoed back in responses, so the client can ignore those from searches it has moved on from
+	searchID string
+	// enumerate scans the whole range, reporting every golden nonce, or the topK lowest hashes if non-zero
+	enumerate bool
+	topK      int
+}
 
-	targetStr, ok := message.MessageAttributes["Target"]
+func decodeWorkerMessage(message *sqs.Message) (*job, error) {
+	rangeStr, ok := message.MessageAttributes["Range"]
 	if !ok {
-		return nil, errors.New("Message didn't contain key Target")
+		return nil, errors.New("Message didn't contain key Range")
 	}
 
 	messageStr, ok := message.MessageAttributes["Message"]
@@ -69,32 +118,133 @@ func decodeWorkerMessage(message *sqs.Message) (*nonce.WorkerConfig, error) {
 		return nil, errors.New("Message didn't contain key Message")
 	}
 
-	lowerBound, err := strconv.ParseUint(*lowerBoundStr.StringValue, 10, 32)
+	timeoutStr, ok := message.MessageAttributes["Timeout"]
+	if !ok {
+		return nil, errors.New("Message didn't contain key Timeout")
+	}
+
+	algoStr, ok := message.MessageAttributes["Algo"]
+	if !ok {
+		return nil, errors.New("Message didn't contain key Algo")
+	}
+
+	// Only memory-hard algorithms have parameters, so this may be omitted
+	algoParams := ""
+	if algoParamsStr, ok := message.MessageAttributes["AlgoParams"]; ok {
+		algoParams = *algoParamsStr.StringValue
+	}
+
+	// The range is lower:upper, where the upper bound is exclusive, so may be NonceSpace to include the last nonce
+	bounds := strings.Split(*rangeStr.StringValue, ":")
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("Invalid range %s, must be lower:upper", *rangeStr.StringValue)
+	}
+	lowerBound, err := strconv.ParseUint(bounds[0], 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	upperBound, err := strconv.ParseUint(bounds[1], 10, 64)
 	if err != nil {
 		return nil, err
+	} else if upperBound > nonce.NonceSpace {
+		return nil, fmt.Errorf("Invalid upper bound %d, must be at most %d", upperBound, nonce.NonceSpace)
 	}
 
-	upperBound, err := strconv.ParseUint(*upperBoundStr.StringValue, 10, 32)
+	// A pattern replaces the target, so only one of them is sent
+	var target nonce.Target
+	var pattern *nonce.Pattern
+	if patternStr, ok := message.MessageAttributes["Pattern"]; ok {
+		pattern, err = nonce.ParsePattern(*patternStr.StringValue)
+	} else if targetStr, ok := message.MessageAttributes["Target"]; ok {
+		target, err = nonce.ParseTarget(*targetStr.StringValue)
+	} else {
+		return nil, errors.New("Message didn't contain key Target or Pattern")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	timeout, err := strconv.Atoi(*timeoutStr.StringValue)
 	if err != nil {
 		return nil, err
 	}
 
-	target, err := strconv.Atoi(*targetStr.StringValue)
+	hasher, err := nonce.NewHasher(*algoStr.StringValue, algoParams)
 	if err != nil {
 		return nil, err
 	}
 
-	return &nonce.WorkerConfig{
-		Contents:   *messageStr.StringValue,
-		LowerBound: uint32(lowerBound),
-		UpperBound: uint32(upperBound),
-		Target:     target,
-		DebugDesc:  *message.Body,
+	extraNonceStr, ok := message.MessageAttributes["ExtraNonce"]
+	if !ok {
+		return nil, errors.New("Message didn't contain key ExtraNonce")
+	}
+
+	extraNonce, err := strconv.ParseUint(*extraNonceStr.StringValue, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only present when mining a Bitcoin block header
+	var header *nonce.BlockHeader
+	if headerStr, ok := message.MessageAttributes["Header"]; ok {
+		header, err = nonce.ParseBlockHeader(*headerStr.StringValue)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Only present when the nonce isn't 4 bytes big-endian
+	encoding := nonce.DefaultEncoding
+	if encodingStr, ok := message.MessageAttributes["Encoding"]; ok {
+		encoding, err = nonce.ParseEncoding(*encodingStr.StringValue)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Only present when the range isn't searched in sequence
+	var order nonce.Order
+	if orderStr, ok := message.MessageAttributes["Order"]; ok {
+		order, err = nonce.ParseOrder(*orderStr.StringValue)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Only present when enumerating the range rather than stopping at the first golden nonce
+	enumerate := false
+	topK := 0
+	if enumerateStr, ok := message.MessageAttributes["Enumerate"]; ok {
+		enumerate = true
+		topK, err = strconv.Atoi(*enumerateStr.StringValue)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &job{
+		config: &nonce.WorkerConfig{
+			Contents:    *messageStr.StringValue,
+			LowerBound:  uint32(lowerBound),
+			UpperBound:  upperBound,
+			Target:      target,
+			Pattern:     pattern,
+			ExtraNonce:  uint32(extraNonce),
+			Hasher:      hasher,
+			Header:      header,
+			Encoding:    encoding,
+			Order:       order,
+			HashCounter: opsProcessed,
+		},
+		timeout:   time.Duration(timeout) * time.Second,
+		searchID:  *message.Body,
+		enumerate: enumerate,
+		topK:      topK,
 	}, nil
 }
 
 // SendMessageOnQueue sends a message on a queue
-func sendSuccessMessage(session *session.Session, queueName string, gn *nonce.GoldenNonce) (*sqs.SendMessageOutput, error) {
+func sendSuccessMessage(session *session.Session, queueName string, searchID string, gn *nonce.GoldenNonce) (*sqs.SendMessageOutput, error) {
 	svc := sqs.New(session)
 
 	// Get QueueURL
@@ -112,10 +262,18 @@ func sendSuccessMessage(session *session.Session, queueName string, gn *nonce.Go
 				DataType:    aws.String("Number"),
 				StringValue: aws.String("1"),
 			},
+			"SearchID": &sqs.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String(searchID),
+			},
 			"Nonce": &sqs.MessageAttributeValue{
 				DataType:    aws.String("Number"),
 				StringValue: aws.String(strconv.FormatUint(uint64(gn.Nonce), 10)),
 			},
+			"ExtraNonce": &sqs.MessageAttributeValue{
+				DataType:    aws.String("Number"),
+				StringValue: aws.String(strconv.FormatUint(uint64(gn.ExtraNonce), 10)),
+			},
 			"Hash": &sqs.MessageAttributeValue{
 				DataType:    aws.String("String"),
 				StringValue: aws.String(gn.Hash),
@@ -126,7 +284,8 @@ func sendSuccessMessage(session *session.Session, queueName string, gn *nonce.Go
 	})
 }
 
-func sendFailureMessage(session *session.Session, queueName string, errMsg string) (*sqs.SendMessageOutput, error) {
+// sendFailureMessage reports that no golden nonce was found, along with the best hash found instead if there is one
+func sendFailureMessage(session *session.Session, queueName string, searchID string, errMsg string, partial *nonce.PartialResult) (*sqs.SendMessageOutput, error) {
 	svc := sqs.New(session)
 
 	// Get QueueURL
@@ -137,17 +296,103 @@ func sendFailureMessage(session *session.Session, queueName string, errMsg strin
 		return nil, err
 	}
 
-	return svc.SendMessage(&sqs.SendMessageInput{
-		DelaySeconds: aws.Int64(0),
-		MessageAttributes: map[string]*sqs.MessageAttributeValue{
-			"Success": &sqs.MessageAttributeValue{
-				DataType:    aws.String("Number"),
-				StringValue: aws.String("0"),
-			},
+	attributes := map[string]*sqs.MessageAttributeValue{
+		"Success": &sqs.MessageAttributeValue{
+			DataType:    aws.String("Number"),
+			StringValue: aws.String("0"),
 		},
-		MessageBody: aws.String(errMsg),
-		QueueUrl:    resultURL.QueueUrl,
+		"SearchID": &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(searchID),
+		},
+	}
+	if partial != nil {
+		attributes["Hashes"] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("Number"),
+			StringValue: aws.String(strconv.FormatUint(partial.Hashes, 10)),
+		}
+	}
+	if partial != nil && partial.Best != nil {
+		attributes["Nonce"] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("Number"),
+			StringValue: aws.String(strconv.FormatUint(uint64(partial.Best.Nonce), 10)),
+		}
+		attributes["ExtraNonce"] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("Number"),
+			StringValue: aws.String(strconv.FormatUint(uint64(partial.Best.ExtraNonce), 10)),
+		}
+		attributes["Hash"] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(partial.Best.Hash),
+		}
+		attributes["LeadingZeros"] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("Number"),
+			StringValue: aws.String(strconv.Itoa(partial.LeadingZeros)),
+		}
+	}
+
+	return svc.SendMessage(&sqs.SendMessageInput{
+		DelaySeconds:      aws.Int64(0),
+		MessageAttributes: attributes,
+		MessageBody:       aws.String(errMsg),
+		QueueUrl:          resultURL.QueueUrl,
+	})
+}
+
+// sendEnumerationMessages streams the nonces found by an enumeration in chunks, as SQS limits the size of a message.
+// The client knows the worker has finished once it receives the chunk marked Final.
+func sendEnumerationMessages(session *session.Session, queueName string, searchID string, e *nonce.Enumeration) error {
+	svc := sqs.New(session)
+
+	// Get QueueURL
+	resultURL, err := svc.GetQueueUrl(&sqs.GetQueueUrlInput{
+		QueueName: aws.String(queueName),
 	})
+	if err != nil {
+		return err
+	}
+
+	// Always send at least one chunk, so the client hears back even when nothing was found
+	for start := 0; start == 0 || start < len(e.Nonces); start += enumerationChunkSize {
+		end := start + enumerationChunkSize
+		final := "0"
+		if end >= len(e.Nonces) {
+			end = len(e.Nonces)
+			final = "1"
+		}
+		body, err := json.Marshal(e.Nonces[start:end])
+		if err != nil {
+			return err
+		}
+
+		_, err = svc.SendMessage(&sqs.SendMessageInput{
+			DelaySeconds: aws.Int64(0),
+			MessageAttributes: map[string]*sqs.MessageAttributeValue{
+				"Success": &sqs.MessageAttributeValue{
+					DataType:    aws.String("Number"),
+					StringValue: aws.String("1"),
+				},
+				"SearchID": &sqs.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String(searchID),
+				},
+				"Final": &sqs.MessageAttributeValue{
+					DataType:    aws.String("Number"),
+					StringValue: aws.String(final),
+				},
+				"Hashes": &sqs.MessageAttributeValue{
+					DataType:    aws.String("Number"),
+					StringValue: aws.String(strconv.FormatUint(e.Hashes, 10)),
+				},
+			},
+			MessageBody: aws.String(string(body)),
+			QueueUrl:    resultURL.QueueUrl,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func deleteWorkerMessage(session *session.Session, queueName string, message *sqs.Message) (*sqs.DeleteMessageOutput, error) {
@@ -167,46 +412,216 @@ func deleteWorkerMessage(session *session.Session, queueName string, message *sq
 	})
 }
 
-func main() {
-	// Prometheus metrics
+// shutdownContext is cancelled once the worker is asked to shut down
+func shutdownContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
-		http.Handle("/metrics", promhttp.Handler())
-		http.ListenAndServe(":2112", nil)
+		<-c
+		log.Println("Gracefully shutting down...")
+		cancel()
 	}()
+	return ctx
+}
 
-	session, err := session.NewSession(&aws.Config{
-		Region: aws.String("us-east-1")},
-	)
-	checkError(err, "Couldn't create session")
+// processJob searches for the golden nonce described by message, and reports the outcome on the output queue. If
+// ctx ends because the worker is shutting down, the job is released for another worker instead, and if the client
+// cancels its search the job is dropped. A job which can't be decoded or searched is reported as failed and removed,
+// while errors talking to SQS are only logged, leaving the job to be redelivered if it wasn't deleted.
+func processJob(ctx context.Context, session *session.Session, message *sqs.Message, cancels *cancellations) {
+	j, err := decodeWorkerMessage(message)
+	if err != nil {
+		// Another worker couldn't decode it either, so it is removed rather than left to be redelivered
+		rejectJob(session, message, *message.Body, err)
+		return
+	}
+	decoded := j.config
 
-	message, err := getMessageFromQueue(session, "INPUT_QUEUE")
-	checkError(err, "Couldn't receive message")
+	if cancels.isCancelled(j.searchID) {
+		dropJob(session, message)
+		return
+	}
 
-	if len(message.Messages) == 0 {
-		checkError(errors.New("Empty messages"), "No messages returned")
+	// Keep the job from being redelivered while it is still being searched
+	err = changeMessageVisibility(session, "INPUT_QUEUE", message, j.timeout+visibilityGrace)
+	logError(err, "Couldn't extend message visibility")
+
+	jobID := *message.MessageId
+	// The checkpoint doesn't hold the nonces an enumeration has found, so it always starts afresh
+	if !j.enumerate {
+		decoded.Cursor = loadCheckpoint(jobID)
+		if decoded.Cursor != nil {
+			log.Printf("Resuming from checkpoint after %d hashes", decoded.Cursor.Hashes)
+		}
 	}
+	metrics := newJobMetrics(jobID, decoded)
+	decoded.ProgressPeriod = progressPeriod
+	decoded.Progress = func(p nonce.Progress) {
+		metrics.progress(p)
+		log.Printf("Progress: %d hashes, at nonce %d, best leading zeros %d", p.Hashes, p.Nonce, p.BestZeros)
+		if j.enumerate {
+			return
+		}
+		if err := saveCheckpoint(jobID, p.Cursor); err != nil {
+			log.Printf("Couldn't save checkpoint: %s", err.Error())
+		}
+	}
+
+	searchCtx, cancel := context.WithTimeout(ctx, j.timeout)
+	defer cancel()
+	cancels.start(j.searchID, cancel)
+	defer cancels.finish()
 
-	decoded, err := decodeWorkerMessage(message.Messages[0])
-	checkError(err, "Couldn't decode message")
+	if j.enumerate {
+		processEnumeration(ctx, searchCtx, session, message, j, metrics)
+		return
+	}
 
-	n, err := nonce.CalculateGoldenNonce(decoded)
+	n, err := nonce.CalculateGoldenNonceContext(searchCtx, decoded)
 	if err != nil {
-		if err, ok := err.(*nonce.NoNonceFoundError); ok {
-			_, sendErr := sendFailureMessage(session, "OUTPUT_QUEUE", err.Error())
-			checkError(sendErr, "Couldn't send failure message")
+		var partial *nonce.PartialResult
+		switch e := err.(type) {
+		case *nonce.NoNonceFoundError:
+			// The whole range was searched, so there's nothing to resume. A cancelled search keeps its checkpoint.
+			clearCheckpoint()
+			metrics.finish(outcomeNotFound)
+			partial = e.Partial
+		case *nonce.SearchCancelledError:
+			metrics.finish(outcomeCancelled)
+			if ctx.Err() != nil {
+				releaseJob(session, message)
+				return
+			} else if cancels.isCancelled(j.searchID) {
+				// The job won't come back, so there's nothing to resume
+				clearCheckpoint()
+				dropJob(session, message)
+				return
+			}
+			partial = e.Partial
+		default:
+			metrics.finish(outcomeError)
+			rejectJob(session, message, j.searchID, err)
+			return
+		}
 
-			// Delete message to stop another worker from taking it
-			_, err := deleteWorkerMessage(session, "INPUT_QUEUE", message.Messages[0])
-			checkError(err, "Couldn't delete message from queue")
+		if partial != nil && partial.Best != nil {
+			log.Printf("Best hash %s from nonce %d, %d leading zeros after %d hashes", partial.Best.Hash, partial.Best.Nonce, partial.LeadingZeros, partial.Hashes)
+		}
+		_, sendErr := sendFailureMessage(session, "OUTPUT_QUEUE", j.searchID, err.Error(), partial)
+		if sendErr != nil {
+			// Leave the message to be redelivered, so that the client hears back in the end
+			logError(sendErr, "Couldn't send failure message")
 			return
 		}
-		checkError(err, "Couldn't calculate golden nonce")
+
+		// Delete message to stop another worker from taking it
+		_, err := deleteWorkerMessage(session, "INPUT_QUEUE", message)
+		logError(err, "Couldn't delete message from queue")
+		return
+	}
+	clearCheckpoint()
+	metrics.finish(outcomeSuccess)
+
+	// Delete message to stop another worker from taking it
+	_, err = sendSuccessMessage(session, "OUTPUT_QUEUE", j.searchID, n)
+	if err != nil {
+		logError(err, "Couldn't send success message")
+		return
+	}
+	_, err = deleteWorkerMessage(session, "INPUT_QUEUE", message)
+	logError(err, "Couldn't delete worker message")
+}
+
+// processEnumeration scans the job's whole range and streams back what it found. If the search times out the
+// nonces found so far are still reported, as the hash count lets the client account for the partial scan. If the
+// worker is shutting down, ending shutdown, the job is released instead.
+func processEnumeration(shutdown context.Context, ctx context.Context, session *session.Session, message *sqs.Message, j *job, metrics *jobMetrics) {
+	e, err := nonce.EnumerateGoldenNonces(ctx, j.config, j.topK)
+	if e == nil {
+		metrics.finish(outcomeError)
+		rejectJob(session, message, j.searchID, err)
+		return
+	} else if err != nil {
+		log.Printf("Enumeration stopped early: %s", err.Error())
+		metrics.finish(outcomeCancelled)
+		if shutdown.Err() != nil {
+			releaseJob(session, message)
+			return
+		}
+	} else if len(e.Nonces) == 0 {
+		metrics.finish(outcomeNotFound)
+	} else {
+		metrics.finish(outcomeSuccess)
+	}
+	log.Printf("Enumerated %d nonces from %d hashes", len(e.Nonces), e.Hashes)
+
+	err = sendEnumerationMessages(session, "OUTPUT_QUEUE", j.searchID, e)
+	if err != nil {
+		logError(err, "Couldn't send enumeration messages")
 		return
 	}
 
 	// Delete message to stop another worker from taking it
-	_, err = sendSuccessMessage(session, "OUTPUT_QUEUE", n)
-	checkError(err, "Couldn't send success message")
-	_, err = deleteWorkerMessage(session, "INPUT_QUEUE", message.Messages[0])
-	checkError(err, "Couldn't delete worker message")
+	_, err = deleteWorkerMessage(session, "INPUT_QUEUE", message)
+	logError(err, "Couldn't delete worker message")
+}
+
+// releaseJob hands a job interrupted by shutting down back to the input queue, rather than reporting it as failed, so
+// that another worker takes it on. Its checkpoint is kept, so it resumes if it comes back to this worker.
+func releaseJob(session *session.Session, message *sqs.Message) {
+	log.Printf("Releasing job %s to the input queue", *message.MessageId)
+	err := changeMessageVisibility(session, "INPUT_QUEUE", message, 0)
+	logError(err, "Couldn't release worker message")
+}
+
+// dropJob removes a job whose search the client has cancelled, without reporting on it as nobody is waiting
+func dropJob(session *session.Session, message *sqs.Message) {
+	log.Printf("Dropping job %s of a cancelled search", *message.MessageId)
+	_, err := deleteWorkerMessage(session, "INPUT_QUEUE", message)
+	logError(err, "Couldn't delete worker message")
+}
+
+// rejectJob removes a job which can't be searched, as it would fail on every worker it was redelivered to, and
+// reports the error to the client waiting on searchID
+func rejectJob(session *session.Session, message *sqs.Message, searchID string, err error) {
+	log.Printf("Rejecting job %s: %s", *message.MessageId, err.Error())
+	_, sendErr := sendFailureMessage(session, "OUTPUT_QUEUE", searchID, err.Error(), nil)
+	logError(sendErr, "Couldn't send failure message")
+	_, err = deleteWorkerMessage(session, "INPUT_QUEUE", message)
+	logError(err, "Couldn't delete worker message")
+}
+
+func main() {
+	// Prometheus metrics
+	go func() {
+		http.Handle("/metrics", promhttp.Handler())
+		http.ListenAndServe(":2112", nil)
+	}()
+
+	session, err := session.NewSession(&aws.Config{
+		Region: aws.String("us-east-1")},
+	)
+	checkError(err, "Couldn't create session")
+	log.Printf("Hashing SHA-256 with %s", nonce.SHA256Backend())
+
+	// Keep taking jobs until shut down, as the client hands out further extra nonce partitions as each one fails
+	ctx := shutdownContext()
+	cancels := newCancellations()
+	go cancels.poll(ctx, session)
+	for ctx.Err() == nil {
+		message, err := getMessageFromQueue(session, "INPUT_QUEUE")
+		if err != nil {
+			// Wait before trying again, as receiving doesn't block when it fails
+			logError(err, "Couldn't receive message")
+			time.Sleep(cancelPollInterval)
+			continue
+		}
+
+		if len(message.Messages) == 0 {
+			continue
+		}
+		processJob(ctx, session, message.Messages[0], cancels)
+	}
 }
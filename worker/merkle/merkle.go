@@ -0,0 +1,193 @@
+// Package merkle builds Bitcoin-style Merkle trees of transactions, and the inclusion proofs SPV clients check
+package merkle
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// maxTransactionSize is the longest line ReadTransactions accepts
+const maxTransactionSize = 1 << 20
+
+// Hash is a double SHA-256 digest in internal byte order, the reverse of how Bitcoin displays it
+type Hash [32]byte
+
+// ParseHash reads a hash in the reversed hex form given by String
+func ParseHash(s string) (Hash, error) {
+	var h Hash
+	data, err := hex.DecodeString(s)
+	if err != nil || len(data) != len(h) {
+		return h, fmt.Errorf("Invalid hash %q, must be 64 hex digits", s)
+	}
+	for i := range data {
+		h[len(h)-1-i] = data[i]
+	}
+	return h, nil
+}
+
+// String hex encodes the hash reversed, as block explorers show transaction ids and Merkle roots
+func (h Hash) String() string {
+	var reversed Hash
+	for i := range h {
+		reversed[len(h)-1-i] = h[i]
+	}
+	return hex.EncodeToString(reversed[:])
+}
+
+// MarshalText encodes the hash as String does, so it reads naturally in JSON
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText reads a hash in the form given by String
+func (h *Hash) UnmarshalText(text []byte) error {
+	parsed, err := ParseHash(string(text))
+	if err != nil {
+		return err
+	}
+	*h = parsed
+	return nil
+}
+
+// TxID is the double SHA-256 of a transaction, which is its leaf in the tree
+func TxID(tx []byte) Hash {
+	first := sha256.Sum256(tx)
+	return sha256.Sum256(first[:])
+}
+
+// hashPair is the parent of two nodes, the double SHA-256 of their concatenation
+func hashPair(left Hash, right Hash) Hash {
+	var data [64]byte
+	copy(data[:32], left[:])
+	copy(data[32:], right[:])
+	return TxID(data[:])
+}
+
+// Tree is a Merkle tree, where each level pairs up the nodes of the one below. A level with an odd number of
+// nodes pairs its last node with itself, as Bitcoin does.
+type Tree struct {
+	// levels runs from the leaves up to the root
+	levels [][]Hash
+}
+
+// New builds the tree over the given leaves
+func New(leaves []Hash) (*Tree, error) {
+	if len(leaves) == 0 {
+		return nil, errors.New("Invalid merkle tree, must have at least one leaf")
+	}
+
+	t := &Tree{levels: [][]Hash{leaves}}
+	for level := leaves; len(level) > 1; {
+		parents := make([]Hash, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			parents = append(parents, hashPair(level[i], level[sibling(level, i)]))
+		}
+		t.levels = append(t.levels, parents)
+		level = parents
+	}
+	return t, nil
+}
+
+// FromTransactions builds the tree whose leaves are the transactions' ids
+func FromTransactions(txs [][]byte) (*Tree, error) {
+	leaves := make([]Hash, len(txs))
+	for i, tx := range txs {
+		leaves[i] = TxID(tx)
+	}
+	return New(leaves)
+}
+
+// sibling is the index of the node paired with level[i], which is itself for the last of an odd number
+func sibling(level []Hash, i int) int {
+	if i%2 == 1 {
+		return i - 1
+	} else if i+1 < len(level) {
+		return i + 1
+	}
+	return i
+}
+
+// Root is the hash at the top of the tree, which a block commits to
+func (t *Tree) Root() Hash {
+	return t.levels[len(t.levels)-1][0]
+}
+
+// Len is the number of leaves
+func (t *Tree) Len() int {
+	return len(t.levels[0])
+}
+
+// Proof is the path from a leaf up to the root, which shows the leaf is in the tree without the other leaves
+type Proof struct {
+	Index int  `json:"index"`
+	Leaf  Hash `json:"leaf"`
+	// Siblings are the hashes paired with the path at each level, from the leaves up
+	Siblings []Hash `json:"siblings"`
+}
+
+// Proof returns the inclusion proof of the leaf at index i
+func (t *Tree) Proof(i int) (*Proof, error) {
+	if i < 0 || i >= t.Len() {
+		return nil, fmt.Errorf("Invalid leaf index %d, must be in range [0, %d)", i, t.Len())
+	}
+
+	p := &Proof{Index: i, Leaf: t.levels[0][i]}
+	for _, level := range t.levels[:len(t.levels)-1] {
+		p.Siblings = append(p.Siblings, level[sibling(level, i)])
+		i /= 2
+	}
+	return p, nil
+}
+
+// Verify reports whether the proof leads from its leaf to root. The index decides which side each sibling is on.
+func (p *Proof) Verify(root Hash) bool {
+	if p.Index < 0 || p.Index>>uint(len(p.Siblings)) != 0 {
+		return false
+	}
+	return p.Root() == root
+}
+
+// Root is the root the proof leads to from its leaf. Miners use it to recompute the root from a changed coinbase,
+// the leaf at index 0, without the other transactions.
+func (p *Proof) Root() Hash {
+	h, i := p.Leaf, p.Index
+	for _, s := range p.Siblings {
+		if i%2 == 1 {
+			h = hashPair(s, h)
+		} else {
+			h = hashPair(h, s)
+		}
+		i /= 2
+	}
+	return h
+}
+
+// ReadTransactions reads the file at path with one transaction per line, such as a JSON lines file. Empty lines
+// are skipped.
+func ReadTransactions(path string) ([][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var txs [][]byte
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxTransactionSize)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			txs = append(txs, append([]byte(nil), scanner.Bytes()...))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(txs) == 0 {
+		return nil, fmt.Errorf("Invalid transactions file %s, must have at least one transaction", path)
+	}
+	return txs, nil
+}
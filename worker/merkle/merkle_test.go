@@ -0,0 +1,179 @@
+package merkle
+
+import (
+	"fmt"
+	"testing"
+)
+
+// mustParseHashes reads txids in the reversed hex form block explorers show
+func mustParseHashes(t *testing.T, hexes ...string) []Hash {
+	t.Helper()
+	hashes := make([]Hash, len(hexes))
+	for i, s := range hexes {
+		h, err := ParseHash(s)
+		if err != nil {
+			t.Fatalf("ParseHash(%s): %v", s, err)
+		}
+		hashes[i] = h
+	}
+	return hashes
+}
+
+// referenceRoot computes the root as Bitcoin Core describes it, duplicating the last hash of any odd level
+func referenceRoot(leaves []Hash) Hash {
+	level := append([]Hash(nil), leaves...)
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		var parents []Hash
+		for i := 0; i < len(level); i += 2 {
+			parents = append(parents, hashPair(level[i], level[i+1]))
+		}
+		level = parents
+	}
+	return level[0]
+}
+
+// testLeaves returns n distinct leaves
+func testLeaves(n int) []Hash {
+	leaves := make([]Hash, n)
+	for i := range leaves {
+		leaves[i] = TxID([]byte(fmt.Sprintf("tx %d", i)))
+	}
+	return leaves
+}
+
+func TestBitcoinRoots(t *testing.T) {
+	tests := []struct {
+		name  string
+		txids []string
+		root  string
+	}{
+		{
+			"genesis, a single leaf",
+			[]string{"4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"},
+			"4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b",
+		},
+		{
+			"block 170",
+			[]string{
+				"b1fea52486ce0c62bb442b530a3f0132b826c74e473d1f2c220bfa78111c5082",
+				"f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16",
+			},
+			"7dac2c5666815c17a3b36427de37bb9d2e2c5ccec3f8633eb91a4205cb4c10ff",
+		},
+		{
+			"block 100000",
+			[]string{
+				"8c14f0db3df150123e6f3dbbf30f8b955a8249b62ac1d1ff16284aefa3d06d87",
+				"fff2525b8931402dd09222c50775608f75787bd2b87e56995a7bdd30f79702c4",
+				"6359f0868171b1d194cbee1af2f16ea598ae8fad666d9b012c8ed2b79a236ec4",
+				"e9a66845e05d5abc0ad04ec80f774a7e585c6e8db975962d069a522137b80c1d",
+			},
+			"f3e94742aca4b5ef85488dc37c06c3282295ffec960994b2c0d5ac2a25a95766",
+		},
+	}
+	for _, test := range tests {
+		tree, err := New(mustParseHashes(t, test.txids...))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got := tree.Root().String(); got != test.root {
+			t.Errorf("%s: root = %s, want %s", test.name, got, test.root)
+		}
+	}
+}
+
+func TestOddLevels(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 5, 6, 7, 9, 11, 17} {
+		leaves := testLeaves(n)
+		tree, err := New(leaves)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := tree.Root(), referenceRoot(leaves); got != want {
+			t.Errorf("%d leaves: root = %s, want %s", n, got, want)
+		}
+	}
+
+	// With three leaves, the third is paired with itself
+	leaves := testLeaves(3)
+	tree, _ := New(leaves)
+	want := hashPair(hashPair(leaves[0], leaves[1]), hashPair(leaves[2], leaves[2]))
+	if tree.Root() != want {
+		t.Errorf("3 leaves: root = %s, want %s", tree.Root(), want)
+	}
+}
+
+func TestProofs(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 4, 5, 7, 8, 13} {
+		tree, err := New(testLeaves(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		root := tree.Root()
+		for i := 0; i < n; i++ {
+			proof, err := tree.Proof(i)
+			if err != nil {
+				t.Fatalf("%d leaves: Proof(%d): %v", n, i, err)
+			}
+			if !proof.Verify(root) {
+				t.Errorf("%d leaves: proof of leaf %d doesn't verify", n, i)
+			}
+
+			tampered := *proof
+			tampered.Leaf[0] ^= 1
+			if tampered.Verify(root) {
+				t.Errorf("%d leaves: proof of tampered leaf %d verifies", n, i)
+			}
+
+			if len(proof.Siblings) > 0 {
+				tampered = *proof
+				tampered.Siblings = append([]Hash(nil), proof.Siblings...)
+				tampered.Siblings[0][31] ^= 0x80
+				if tampered.Verify(root) {
+					t.Errorf("%d leaves: proof of leaf %d with a tampered sibling verifies", n, i)
+				}
+			}
+		}
+
+		for _, i := range []int{-1, n} {
+			if _, err := tree.Proof(i); err == nil {
+				t.Errorf("%d leaves: Proof(%d) succeeded, want an error", n, i)
+			}
+		}
+	}
+}
+
+func TestProofIndex(t *testing.T) {
+	tree, _ := New(testLeaves(4))
+	proof, _ := tree.Proof(1)
+
+	// The index decides which side each sibling is hashed on, so another index fails, as does one too large for
+	// the number of siblings
+	for _, index := range []int{-1, 0, 2, 3, 5} {
+		moved := *proof
+		moved.Index = index
+		if moved.Verify(tree.Root()) {
+			t.Errorf("Proof of leaf 1 verifies with index %d", index)
+		}
+	}
+}
+
+func TestBitcoinProofs(t *testing.T) {
+	txids := mustParseHashes(t,
+		"8c14f0db3df150123e6f3dbbf30f8b955a8249b62ac1d1ff16284aefa3d06d87",
+		"fff2525b8931402dd09222c50775608f75787bd2b87e56995a7bdd30f79702c4",
+		"6359f0868171b1d194cbee1af2f16ea598ae8fad666d9b012c8ed2b79a236ec4",
+		"e9a66845e05d5abc0ad04ec80f774a7e585c6e8db975962d069a522137b80c1d",
+	)
+	root := mustParseHashes(t, "f3e94742aca4b5ef85488dc37c06c3282295ffec960994b2c0d5ac2a25a95766")[0]
+	tree, _ := New(txids)
+	for i := range txids {
+		proof, _ := tree.Proof(i)
+		if !proof.Verify(root) {
+			t.Errorf("Proof of block 100000's transaction %d doesn't verify", i)
+		}
+	}
+}
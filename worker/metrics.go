@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jaylees14/pow/worker/nonce"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Outcomes a job can finish with, used as the outcome label of worker_jobs_total
+const (
+	outcomeSuccess   = "success"
+	outcomeNotFound  = "not_found"
+	outcomeCancelled = "cancelled"
+	outcomeError     = "error"
+)
+
+var (
+	// The gauges are per job, and deleted when it finishes, whereas the histogram and counter only have the worker's
+	// label so their series don't grow with every job
+	jobLabels    = []string{"job_id", "worker_id", "lower_bound", "upper_bound"}
+	workerLabels = []string{"worker_id"}
+
+	opsProcessed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "worker_processed_ops_total",
+		Help: "The total number of processed nonces",
+	})
+	hashRate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "worker_hash_rate",
+		Help: "The number of nonces hashed per second by the current job",
+	}, jobLabels)
+	rangeProgress = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "worker_range_progress_ratio",
+		Help: "The fraction of the job's nonce range searched so far",
+	}, jobLabels)
+	bestLeadingZeros = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "worker_best_leading_zeros",
+		Help: "The most leading zero bits of any hash found by the job so far",
+	}, jobLabels)
+	searchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "worker_search_duration_seconds",
+		Help:    "The time taken to search a job's nonce range",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	}, workerLabels)
+	jobsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "worker_jobs_total",
+		Help: "The total number of jobs finished, by outcome",
+	}, append(workerLabels, "outcome"))
+)
+
+// workerID identifies this worker in metric labels, taken from WORKER_ID or else the hostname
+func workerID() string {
+	if id := os.Getenv("WORKER_ID"); id != "" {
+		return id
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return host
+}
+
+// jobMetrics tracks the metrics of a single job from the progress reported by its search
+type jobMetrics struct {
+	labels     prometheus.Labels
+	size       float64
+	start      time.Time
+	lastTime   time.Time
+	lastHashes uint64
+}
+
+func newJobMetrics(jobID string, config *nonce.WorkerConfig) *jobMetrics {
+	now := time.Now()
+	m := &jobMetrics{
+		labels: prometheus.Labels{
+			"job_id":      jobID,
+			"worker_id":   workerID(),
+			"lower_bound": strconv.FormatUint(uint64(config.LowerBound), 10),
+			"upper_bound": strconv.FormatUint(uint64(config.UpperBound), 10),
+		},
+		size:     float64(config.UpperBound - uint64(config.LowerBound)),
+		start:    now,
+		lastTime: now,
+	}
+	// A resumed search starts from the hashes done before the checkpoint
+	if config.Cursor != nil {
+		m.lastHashes = config.Cursor.Hashes
+	}
+	return m
+}
+
+// progress updates the gauges from a progress callback of the search
+func (m *jobMetrics) progress(p nonce.Progress) {
+	now := time.Now()
+	if elapsed := now.Sub(m.lastTime).Seconds(); elapsed > 0 {
+		hashRate.With(m.labels).Set(float64(p.Hashes-m.lastHashes) / elapsed)
+	}
+	m.lastTime = now
+	m.lastHashes = p.Hashes
+
+	if m.size > 0 {
+		rangeProgress.With(m.labels).Set(float64(p.Hashes) / m.size)
+	}
+	bestLeadingZeros.With(m.labels).Set(float64(p.BestZeros))
+}
+
+// finish records the duration and outcome of the job, and removes its gauges so finished jobs don't linger
+func (m *jobMetrics) finish(outcome string) {
+	worker := m.labels["worker_id"]
+	searchDuration.WithLabelValues(worker).Observe(time.Since(m.start).Seconds())
+	jobsTotal.WithLabelValues(worker, outcome).Inc()
+
+	hashRate.Delete(m.labels)
+	rangeProgress.Delete(m.labels)
+	bestLeadingZeros.Delete(m.labels)
+}
@@ -0,0 +1,57 @@
+package nonce
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// calibrationCheckInterval is how many hashes each goroutine computes between looking at the clock, small enough
+// that memory-hard hashers don't overrun the calibration by much
+const calibrationCheckInterval = 16
+
+// MeasureHashRate times config's search on this machine for duration, returning how many hashes a second it
+// computes. It takes in the hasher and its parameters, the encoding, the SHA-256 backend and config.Threads, but
+// ignores the target, so nothing is returned early.
+func MeasureHashRate(config *WorkerConfig, duration time.Duration) (float64, error) {
+	c := *config
+	c.LowerBound, c.UpperBound, c.Cursor = 0, NonceSpace, nil
+	state, err := newSearchState(&c, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	threads := c.Threads
+	if threads <= 0 {
+		threads = runtime.NumCPU()
+	}
+	rates := make([]float64, threads)
+	deadline := time.Now().Add(duration)
+	var wg sync.WaitGroup
+	for t := 0; t < threads; t++ {
+		wg.Add(1)
+		go func(t int) {
+			defer wg.Done()
+			candidate := newCandidate(state)
+			start := time.Now()
+			// Each goroutine starts in its own part of the nonce space, as a search would
+			position := uint64(t) * (NonceSpace / uint64(threads))
+			count := uint64(0)
+			for {
+				candidate.hashAt(uint32(position+count), NonceSpace)
+				count++
+				if count%calibrationCheckInterval == 0 && time.Now().After(deadline) {
+					break
+				}
+			}
+			rates[t] = float64(count) / time.Since(start).Seconds()
+		}(t)
+	}
+	wg.Wait()
+
+	total := 0.0
+	for _, rate := range rates {
+		total += rate
+	}
+	return total, nil
+}
@@ -0,0 +1,168 @@
+package nonce
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Nonce encoding formats
+const (
+	BigEndian    = "be"
+	LittleEndian = "le"
+	Decimal      = "dec"
+	Hex          = "hex"
+)
+
+// NoncePlaceholder marks where the nonce is placed in WorkerConfig.Contents. Without one it is appended.
+const NoncePlaceholder = "{nonce}"
+
+// Encoding describes how a nonce is written into the hashed payload
+type Encoding struct {
+	Format string
+	// Width is the number of bytes of a binary nonce, 4 or 8, defaulting to 4. Text nonces are zero-padded to Width
+	// digits, or not padded at all if it is zero.
+	Width int
+}
+
+// DefaultEncoding writes the nonce as 4 bytes big-endian
+var DefaultEncoding = Encoding{BigEndian, 4}
+
+// headerEncoding places the nonce in a Bitcoin block header
+var headerEncoding = Encoding{LittleEndian, 4}
+
+// ParseEncoding reads an encoding written as format[:width], e.g. "le", "be:8", "dec" or "hex:8".
+// An empty string gives DefaultEncoding.
+func ParseEncoding(s string) (Encoding, error) {
+	if len(s) == 0 {
+		return DefaultEncoding, nil
+	}
+
+	parts := strings.SplitN(s, ":", 2)
+	e := Encoding{Format: parts[0]}
+	if len(parts) == 2 {
+		width, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return Encoding{}, fmt.Errorf("Invalid nonce width %s, must be a number", parts[1])
+		}
+		e.Width = width
+	}
+
+	if len(e.Format) == 0 {
+		return Encoding{}, fmt.Errorf("Unknown nonce encoding %s, must be be, le, dec or hex", s)
+	}
+	e = e.withDefaults()
+	if err := e.validate(); err != nil {
+		return Encoding{}, err
+	}
+	return e, nil
+}
+
+// withDefaults gives DefaultEncoding if there is no format, and a binary encoding without a width 4 bytes
+func (e Encoding) withDefaults() Encoding {
+	if len(e.Format) == 0 {
+		return DefaultEncoding
+	} else if (e.Format == BigEndian || e.Format == LittleEndian) && e.Width == 0 {
+		e.Width = 4
+	}
+	return e
+}
+
+// validate checks the encoding's format and width, once its defaults are filled in
+func (e Encoding) validate() error {
+	switch e.Format {
+	case BigEndian, LittleEndian:
+		if e.Width != 4 && e.Width != 8 {
+			return errors.New("Invalid nonce width, binary nonces must be 4 or 8 bytes")
+		}
+	case Decimal, Hex:
+		if e.Width < 0 || e.Width > 32 {
+			return errors.New("Invalid nonce width, text nonces must be padded to between 0 and 32 digits")
+		}
+	default:
+		return fmt.Errorf("Unknown nonce encoding %s, must be be, le, dec or hex", e.Format)
+	}
+	return nil
+}
+
+// String formats the encoding as ParseEncoding reads it
+func (e Encoding) String() string {
+	if e.Width == 0 {
+		return e.Format
+	}
+	return fmt.Sprintf("%s:%d", e.Format, e.Width)
+}
+
+// Append appends nonce to dst in this encoding, without allocating if dst has room
+func (e Encoding) Append(dst []byte, nonce uint32) []byte {
+	var buf [8]byte
+	switch e.Format {
+	case LittleEndian:
+		binary.LittleEndian.PutUint64(buf[:], uint64(nonce))
+		return append(dst, buf[:e.Width]...)
+	case Decimal, Hex:
+		base := 10
+		if e.Format == Hex {
+			base = 16
+		}
+		var digits [32]byte
+		text := strconv.AppendUint(digits[:0], uint64(nonce), base)
+		for i := len(text); i < e.Width; i++ {
+			dst = append(dst, '0')
+		}
+		return append(dst, text...)
+	default:
+		binary.BigEndian.PutUint64(buf[:], uint64(nonce))
+		return append(dst, buf[8-e.Width:]...)
+	}
+}
+
+// maxLen is the most bytes Append writes
+func (e Encoding) maxLen() int {
+	switch e.Format {
+	case Decimal:
+		return maxInt(e.Width, 10)
+	case Hex:
+		return maxInt(e.Width, 8)
+	default:
+		return e.Width
+	}
+}
+
+// padded is the encoding zero-padded to its most bytes, so that a value written with it can't run into whatever
+// follows it
+func (e Encoding) padded() Encoding {
+	e.Width = e.maxLen()
+	return e
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// searchPayload splits everything hashed around the nonce. In header mode that is the rolled header, with nothing
+// after the nonce. Otherwise it is Contents with the nonce at NoncePlaceholder, or appended if there isn't one.
+// A non-zero extra nonce comes just before the nonce, in the same encoding padded to its full width, so that
+// different pairs of extra nonce and nonce never write the same payload.
+func searchPayload(config *WorkerConfig, header *BlockHeader, encoding Encoding) ([]byte, []byte) {
+	if header != nil {
+		data := header.Bytes(0)
+		return data[:headerNonceOffset], nil
+	}
+
+	prefix, suffix := config.Contents, ""
+	if i := strings.Index(config.Contents, NoncePlaceholder); i >= 0 {
+		prefix, suffix = config.Contents[:i], config.Contents[i+len(NoncePlaceholder):]
+	}
+
+	prefixBytes := []byte(prefix)
+	if config.ExtraNonce != 0 {
+		prefixBytes = encoding.padded().Append(prefixBytes, config.ExtraNonce)
+	}
+	return prefixBytes, []byte(suffix)
+}
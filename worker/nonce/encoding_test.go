@@ -0,0 +1,85 @@
+package nonce
+
+import "testing"
+
+func TestExtraNoncePayload(t *testing.T) {
+	tests := []struct {
+		encoding   string
+		extraNonce uint32
+		nonce      uint32
+		payload    string
+	}{
+		{"dec", 0, 123, "x123"},
+		{"dec", 1, 23, "x000000000123"},
+		{"dec", 12, 3, "x00000000123"},
+		{"dec:4", 12, 3, "x00000000120003"},
+		{"dec:12", 1, 23, "x000000000001000000000023"},
+		{"hex", 1, 0x23, "x0000000123"},
+		{"hex", 0x12, 3, "x000000123"},
+		{"be", 1, 2, "x\x00\x00\x00\x01\x00\x00\x00\x02"},
+		{"le:8", 1, 2, "x\x01\x00\x00\x00\x00\x00\x00\x00\x02\x00\x00\x00\x00\x00\x00\x00"},
+	}
+	for _, test := range tests {
+		encoding, err := ParseEncoding(test.encoding)
+		if err != nil {
+			t.Fatalf("ParseEncoding(%q): %v", test.encoding, err)
+		}
+		config := &WorkerConfig{Contents: "x", Encoding: encoding, ExtraNonce: test.extraNonce}
+		if got := string(Payload(config, test.nonce)); got != test.payload {
+			t.Errorf("%s payload of extra nonce %d and nonce %d = %q, want %q", test.encoding, test.extraNonce, test.nonce, got, test.payload)
+		}
+	}
+}
+
+func TestExtraNoncePayloadsDiffer(t *testing.T) {
+	for _, format := range []string{"dec", "hex", "dec:3", "hex:2"} {
+		encoding, err := ParseEncoding(format)
+		if err != nil {
+			t.Fatalf("ParseEncoding(%q): %v", format, err)
+		}
+		seen := map[string][2]uint32{}
+		for extraNonce := uint32(0); extraNonce < 300; extraNonce++ {
+			for nonce := uint32(0); nonce < 300; nonce++ {
+				config := &WorkerConfig{Contents: "x", Encoding: encoding, ExtraNonce: extraNonce}
+				payload := string(Payload(config, nonce))
+				if prev, ok := seen[payload]; ok {
+					t.Fatalf("%s payload %q written by extra nonce %d and nonce %d, and by %d and %d", format, payload, prev[0], prev[1], extraNonce, nonce)
+				}
+				seen[payload] = [2]uint32{extraNonce, nonce}
+			}
+		}
+	}
+}
+
+func TestEncodingDefaultWidth(t *testing.T) {
+	tests := []struct {
+		encoding Encoding
+		payload  string
+	}{
+		{Encoding{}, "x\x00\x00\x01\x02"},
+		{Encoding{Format: BigEndian}, "x\x00\x00\x01\x02"},
+		{Encoding{Format: LittleEndian}, "x\x02\x01\x00\x00"},
+		{Encoding{Format: Decimal}, "x258"},
+	}
+	for _, test := range tests {
+		config := &WorkerConfig{Contents: "x", Encoding: test.encoding}
+		if got := string(Payload(config, 0x102)); got != test.payload {
+			t.Errorf("Payload with %+v = %q, want %q", test.encoding, got, test.payload)
+		}
+	}
+}
+
+func TestInvalidEncoding(t *testing.T) {
+	for _, encoding := range []Encoding{{BigEndian, 3}, {LittleEndian, 16}, {Hex, -1}, {"base64", 0}} {
+		config := &WorkerConfig{Contents: "x", UpperBound: 16, Target: TargetFromLeadingZeros(0), Encoding: encoding}
+		if payload := Payload(config, 1); payload != nil {
+			t.Errorf("Payload with %+v = %q, want nil", encoding, payload)
+		}
+		if _, err := CalculateGoldenNonce(config); err == nil {
+			t.Errorf("Search with %+v succeeded, want an error", encoding)
+		}
+		if _, err := NewMiner(WithEncoding(encoding)); err == nil {
+			t.Errorf("NewMiner(WithEncoding(%+v)) succeeded, want an error", encoding)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package nonce
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+// MaxEnumerated is the most nonces an enumeration of every golden nonce keeps, as each is held in memory and sent
+// back to the client
+const MaxEnumerated = 1 << 16
+
+// ErrTooManyNonces is returned by an enumeration of every golden nonce which finds more than MaxEnumerated
+var ErrTooManyNonces = fmt.Errorf("Found more than %d golden nonces, use a harder target or top k", MaxEnumerated)
+
+// Enumeration is the result of scanning a whole range, rather than stopping at the first golden nonce
+type Enumeration struct {
+	// Nonces are ordered from the lowest hash
+	Nonces []GoldenNonce
+	Hashes uint64
+}
+
+// foundHeap is a max-heap of digests, so the worst of the best k found so far can be replaced
+type foundHeap []found
+
+func (h foundHeap) Len() int            { return len(h) }
+func (h foundHeap) Less(i, j int) bool  { return bytes.Compare(h[i].digest, h[j].digest) > 0 }
+func (h foundHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *foundHeap) Push(x interface{}) { *h = append(*h, x.(found)) }
+func (h *foundHeap) Pop() interface{} {
+	old := *h
+	f := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return f
+}
+
+// enumerateRange scans the whole of state.ranges[idx], keeping every nonce meeting the target if k is zero,
+// or else the k lowest hashes. Every range counts the golden nonces it keeps in total, stopping once there are more
+// than MaxEnumerated.
+func enumerateRange(ctx context.Context, state *searchState, idx int, k int, total *int64) ([]found, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	c := newCandidate(state)
+	r := state.ranges[idx]
+	kept := foundHeap{}
+	count := uint64(0)
+	for p := uint64(r.Start); p < r.End; p++ {
+		i := uint32(p)
+		if count == state.checkInterval {
+			state.record(idx, i-1, count, &c.best)
+			count = 0
+			if ctx.Err() != nil {
+				return kept, ctx.Err()
+			}
+		}
+
+		n, hash := c.hashAt(i, r.End)
+		count++
+		if c.best.lower(hash) {
+			c.best.set(n, hash)
+		}
+
+		if k == 0 {
+			if state.target.Met(hash) {
+				if atomic.AddInt64(total, 1) > MaxEnumerated {
+					state.record(idx, i, count, &c.best)
+					return kept, ErrTooManyNonces
+				}
+				kept = append(kept, found{n, append([]byte(nil), hash...)})
+			}
+		} else if len(kept) < k {
+			heap.Push(&kept, found{n, append([]byte(nil), hash...)})
+		} else if bytes.Compare(hash, kept[0].digest) < 0 {
+			// Reuse the evicted digest's buffer, as it is the same length
+			kept[0].nonce = n
+			copy(kept[0].digest, hash)
+			heap.Fix(&kept, 0)
+		}
+	}
+	if count > 0 {
+		state.record(idx, uint32(r.End-1), count, &c.best)
+	}
+	return kept, nil
+}
+
+// EnumerateGoldenNonces searches the whole of config's range instead of stopping at the first golden nonce.
+// If k is zero it returns every nonce meeting the target, otherwise the k nonces with the lowest hashes whether
+// or not they meet it. If ctx is done first the nonces found so far are returned with a SearchCancelledError.
+// Resuming from config.Cursor only enumerates the ranges which remain, as the cursor doesn't hold results. Finding
+// more than MaxEnumerated golden nonces stops the search, returning those kept with ErrTooManyNonces.
+func EnumerateGoldenNonces(ctx context.Context, config *WorkerConfig, k int) (*Enumeration, error) {
+	type result struct {
+		kept []found
+		err  error
+	}
+
+	ranges := initialRanges(config)
+	state, err := newSearchState(config, ranges)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan result, len(ranges))
+	total := int64(0)
+	for i := range ranges {
+		go func(idx int) {
+			kept, err := enumerateRange(ctx, state, idx, k, &total)
+			results <- result{kept, err}
+		}(i)
+	}
+
+	var all []found
+	for range ranges {
+		res := <-results
+		all = append(all, res.kept...)
+		if res.err == ErrTooManyNonces {
+			// Stop the other ranges, whose cancellation is down to this
+			cancel()
+			err = res.err
+		} else if res.err != nil && err == nil {
+			err = &SearchCancelledError{res.err, state.partial()}
+		}
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return bytes.Compare(all[i].digest, all[j].digest) < 0
+	})
+	if k > 0 && len(all) > k {
+		all = all[:k]
+	}
+
+	e := &Enumeration{
+		Nonces: make([]GoldenNonce, 0, len(all)),
+		Hashes: state.hashes,
+	}
+	for _, f := range all {
+		e.Nonces = append(e.Nonces, GoldenNonce{f.nonce, config.ExtraNonce, hex.EncodeToString(f.digest)})
+	}
+	return e, err
+}
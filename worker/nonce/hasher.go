@@ -0,0 +1,116 @@
+package nonce
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/sha3"
+)
+
+// Names of the supported hashing algorithms, as carried in job messages
+const (
+	SHA256D    string = "sha256d"
+	SHA256     string = "sha256"
+	SHA3256    string = "sha3-256"
+	BLAKE2B256 string = "blake2b-256"
+	// SHA1 is only for hashcash stamps, its 160-bit digest being compared against the top of the target
+	SHA1 string = "sha1"
+)
+
+// Hasher computes the proof-of-work digest of a block
+type Hasher interface {
+	// Name identifies the algorithm in job messages
+	Name() string
+	// Hash appends the digest of data to dst and returns the resulting slice
+	Hash(dst []byte, data []byte) []byte
+}
+
+// NewHasher returns the Hasher with the given name, defaulting to SHA256D if name is empty.
+// Memory-hard algorithms take their cost parameters from params, a comma separated list of key=value pairs.
+func NewHasher(name string, params string) (Hasher, error) {
+	switch name {
+	case "", SHA256D:
+		return sha256dHasher{}, nil
+	case SHA256:
+		return sha256Hasher{}, nil
+	case SHA3256:
+		return sha3Hasher{}, nil
+	case BLAKE2B256:
+		return blake2bHasher{}, nil
+	case SHA1:
+		return sha1Hasher{}, nil
+	case SCRYPT:
+		h, err := newScryptHasher(params)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	case ARGON2ID:
+		h, err := newArgon2Hasher(params)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	default:
+		return nil, fmt.Errorf("Unknown hashing algorithm %q", name)
+	}
+}
+
+// sha256dHasher computes SHA-256 twice, as used by Bitcoin
+type sha256dHasher struct{}
+
+func (sha256dHasher) Name() string {
+	return SHA256D
+}
+
+func (sha256dHasher) Hash(dst []byte, data []byte) []byte {
+	firstHash := sha256.Sum256(data)
+	secondHash := sha256.Sum256(firstHash[:])
+	return append(dst, secondHash[:]...)
+}
+
+type sha256Hasher struct{}
+
+func (sha256Hasher) Name() string {
+	return SHA256
+}
+
+func (sha256Hasher) Hash(dst []byte, data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return append(dst, sum[:]...)
+}
+
+type sha3Hasher struct{}
+
+func (sha3Hasher) Name() string {
+	return SHA3256
+}
+
+func (sha3Hasher) Hash(dst []byte, data []byte) []byte {
+	sum := sha3.Sum256(data)
+	return append(dst, sum[:]...)
+}
+
+type blake2bHasher struct{}
+
+func (blake2bHasher) Name() string {
+	return BLAKE2B256
+}
+
+func (blake2bHasher) Hash(dst []byte, data []byte) []byte {
+	sum := blake2b.Sum256(data)
+	return append(dst, sum[:]...)
+}
+
+type sha1Hasher struct{}
+
+func (sha1Hasher) Name() string {
+	return SHA1
+}
+
+func (sha1Hasher) Hash(dst []byte, data []byte) []byte {
+	sum := sha1.Sum(data)
+	return append(dst, sum[:]...)
+}
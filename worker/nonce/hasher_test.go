@@ -0,0 +1,50 @@
+package nonce
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// hasherTest is a known answer for a hasher built by NewHasher
+type hasherTest struct {
+	algo   string
+	params string
+	data   string
+	digest string
+}
+
+func testHashers(t *testing.T, tests []hasherTest) {
+	for _, test := range tests {
+		h, err := NewHasher(test.algo, test.params)
+		if err != nil {
+			t.Fatalf("NewHasher(%q, %q): %v", test.algo, test.params, err)
+		}
+		// Hash appends to dst, which it is given a prefix of
+		got := h.Hash([]byte{0xff}, []byte(test.data))
+		if got[0] != 0xff || hex.EncodeToString(got[1:]) != test.digest {
+			t.Errorf("%s(%s).Hash(%q) = %x, want ff%s", test.algo, test.params, test.data, got, test.digest)
+		}
+	}
+}
+
+func TestHashers(t *testing.T) {
+	testHashers(t, []hasherTest{
+		{"", "", "abc", "4f8b42c22dd3729b519ba6f68d2da7cc5b2d606d05daed5ad5128cc03e6c6358"},
+		{SHA256D, "", "abc", "4f8b42c22dd3729b519ba6f68d2da7cc5b2d606d05daed5ad5128cc03e6c6358"},
+		{SHA256, "", "", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{SHA256, "", "abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{SHA3256, "", "", "a7ffc6f8bf1ed76651c14756a061d662f580ff4de43b49fa82d80a4b80f8434a"},
+		{SHA3256, "", "abc", "3a985da74fe225b2045c172d6bd390bd855f086e3e9d525b46bfe24511431532"},
+		{BLAKE2B256, "", "", "0e5751c026e543b2e8ab2eb06099daa1d1e5df47778f7787faab45cdf12fe3a8"},
+		{BLAKE2B256, "", "abc", "bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319"},
+		{SHA1, "", "abc", "a9993e364706816aba3e25717850c26c9cd0d89d"},
+	})
+}
+
+func TestNewHasherUnknown(t *testing.T) {
+	for _, algo := range []string{"md5", "SHA256", "sha-256"} {
+		if h, err := NewHasher(algo, ""); err == nil {
+			t.Errorf("NewHasher(%q) = %s, want an error", algo, h.Name())
+		}
+	}
+}
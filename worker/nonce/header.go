@@ -0,0 +1,176 @@
+package nonce
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/jaylees14/pow/worker/merkle"
+)
+
+const (
+	// HeaderSize is the length of a serialised Bitcoin block header
+	HeaderSize int = 80
+	// headerNonceOffset is where the little-endian nonce sits in the header
+	headerNonceOffset int = 76
+	// MaxTimestampRoll is the largest extra nonce a header without a coinbase can be rolled by, as it is added to the
+	// timestamp. Ten minutes keeps blocks well within the two hours Bitcoin allows timestamps into the future.
+	MaxTimestampRoll uint32 = 600
+)
+
+// BlockHeader holds the fields of a Bitcoin block header, other than the nonce being searched for
+type BlockHeader struct {
+	Version int32
+	// PrevBlock and MerkleRoot are stored in internal byte order, the reverse of how they are displayed
+	PrevBlock  [32]byte
+	MerkleRoot [32]byte
+	Timestamp  uint32
+	Bits       uint32
+	// Coinbase, if set, is the block's first transaction, and Branch its Merkle branch up to MerkleRoot. The extra
+	// nonce is rolled into the coinbase, as miners do, rather than into the timestamp.
+	Coinbase []byte
+	Branch   []merkle.Hash
+}
+
+// NewBlockHeader builds a header from hashes given in the usual reversed hex form, as shown by block explorers
+func NewBlockHeader(version int32, prevHash string, merkleRoot string, timestamp uint32, bits uint32) (*BlockHeader, error) {
+	header := &BlockHeader{
+		Version:   version,
+		Timestamp: timestamp,
+		Bits:      bits,
+	}
+
+	err := decodeReversedHash(prevHash, header.PrevBlock[:])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid previous block hash: %s", err.Error())
+	}
+
+	err = decodeReversedHash(merkleRoot, header.MerkleRoot[:])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid merkle root: %s", err.Error())
+	}
+	return header, nil
+}
+
+// ParseBlockHeader decodes a header previously encoded with String
+func ParseBlockHeader(s string) (*BlockHeader, error) {
+	fields := strings.Split(s, ":")
+	if len(fields) != 1 && len(fields) != 3 {
+		return nil, fmt.Errorf("Invalid block header %q, must be a header optionally followed by :coinbase:branch", s)
+	}
+	data, err := hex.DecodeString(fields[0])
+	if err != nil {
+		return nil, err
+	} else if len(data) != headerNonceOffset {
+		return nil, fmt.Errorf("Invalid block header, must be %d bytes but got %d", headerNonceOffset, len(data))
+	}
+
+	header := &BlockHeader{
+		Version:   int32(binary.LittleEndian.Uint32(data[0:4])),
+		Timestamp: binary.LittleEndian.Uint32(data[68:72]),
+		Bits:      binary.LittleEndian.Uint32(data[72:76]),
+	}
+	copy(header.PrevBlock[:], data[4:36])
+	copy(header.MerkleRoot[:], data[36:68])
+	if len(fields) == 1 {
+		return header, nil
+	}
+
+	if header.Coinbase, err = hex.DecodeString(fields[1]); err != nil {
+		return nil, fmt.Errorf("Invalid coinbase: %s", err.Error())
+	}
+	branch, err := hex.DecodeString(fields[2])
+	if err != nil || len(branch)%32 != 0 {
+		return nil, fmt.Errorf("Invalid merkle branch, must be a whole number of 32 byte hashes")
+	}
+	header.Branch = make([]merkle.Hash, len(branch)/32)
+	for i := range header.Branch {
+		copy(header.Branch[i][:], branch[i*32:])
+	}
+	return header, nil
+}
+
+// String hex encodes the header without its nonce, for sending to workers, followed by its coinbase and Merkle
+// branch if it has one
+func (h *BlockHeader) String() string {
+	data := h.Bytes(0)
+	s := hex.EncodeToString(data[:headerNonceOffset])
+	if h.Coinbase == nil {
+		return s
+	}
+
+	branch := make([]byte, 0, len(h.Branch)*32)
+	for _, hash := range h.Branch {
+		branch = append(branch, hash[:]...)
+	}
+	return s + ":" + hex.EncodeToString(h.Coinbase) + ":" + hex.EncodeToString(branch)
+}
+
+// Bytes serialises the header with the given nonce
+func (h *BlockHeader) Bytes(nonce uint32) [HeaderSize]byte {
+	var data [HeaderSize]byte
+	binary.LittleEndian.PutUint32(data[0:4], uint32(h.Version))
+	copy(data[4:36], h.PrevBlock[:])
+	copy(data[36:68], h.MerkleRoot[:])
+	binary.LittleEndian.PutUint32(data[68:72], h.Timestamp)
+	binary.LittleEndian.PutUint32(data[72:76], h.Bits)
+	binary.LittleEndian.PutUint32(data[headerNonceOffset:], nonce)
+	return data
+}
+
+// Rolled returns a copy of the header with extraNonce rolled in, giving a fresh nonce space. With a coinbase the
+// extra nonce changes the Merkle root through RolledCoinbase. Otherwise it is added to the timestamp, which only has
+// to be roughly accurate, up to MaxTimestampRoll. An extra nonce of 0 leaves the header unchanged.
+func (h *BlockHeader) Rolled(extraNonce uint32) (*BlockHeader, error) {
+	rolled := *h
+	if extraNonce == 0 {
+		return &rolled, nil
+	} else if h.Coinbase != nil {
+		proof := &merkle.Proof{Leaf: merkle.TxID(h.RolledCoinbase(extraNonce)), Siblings: h.Branch}
+		rolled.MerkleRoot = proof.Root()
+		return &rolled, nil
+	} else if extraNonce > MaxTimestampRoll {
+		return nil, fmt.Errorf("Invalid extra nonce %d, must be at most %d to roll the timestamp of a header without a coinbase", extraNonce, MaxTimestampRoll)
+	}
+	rolled.Timestamp += extraNonce
+	return &rolled, nil
+}
+
+// RolledCoinbase is the coinbase with a non-zero extra nonce appended little-endian, as Bitcoin's coinbase carries
+// it, which the block must hold in place of Coinbase
+func (h *BlockHeader) RolledCoinbase(extraNonce uint32) []byte {
+	coinbase := append([]byte(nil), h.Coinbase...)
+	if extraNonce == 0 {
+		return coinbase
+	}
+	var data [4]byte
+	binary.LittleEndian.PutUint32(data[:], extraNonce)
+	return append(coinbase, data[:]...)
+}
+
+// Target expands the compact nBits field into the full target
+func (h *BlockHeader) Target() Target {
+	return TargetFromCompact(h.Bits)
+}
+
+// decodeReversedHash decodes a 32 byte hash shown in reversed hex into internal byte order
+func decodeReversedHash(s string, dst []byte) error {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return err
+	} else if len(data) != 32 {
+		return fmt.Errorf("must be 32 bytes but got %d", len(data))
+	}
+
+	reverse(data)
+	copy(dst, data)
+	return nil
+}
+
+// reverse reverses a byte slice in place
+func reverse(data []byte) {
+	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+		data[i], data[j] = data[j], data[i]
+	}
+}
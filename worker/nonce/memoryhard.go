@@ -0,0 +1,155 @@
+package nonce
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Names of the memory-hard hashing algorithms, as carried in job messages
+const (
+	SCRYPT   string = "scrypt"
+	ARGON2ID string = "argon2id"
+)
+
+// ScryptHasher computes scrypt with the block as both password and salt, as used by Litecoin. Build it with NewHasher,
+// which checks the parameters.
+type ScryptHasher struct {
+	N int
+	R int
+	P int
+}
+
+// Argon2Hasher computes Argon2id with the block as both password and salt
+type Argon2Hasher struct {
+	Time    uint32
+	Memory  uint32 // in KiB
+	Threads uint8
+}
+
+// newScryptHasher builds a ScryptHasher from params such as "N=1024,r=1,p=1", defaulting to Litecoin's parameters
+func newScryptHasher(params string) (*ScryptHasher, error) {
+	h := &ScryptHasher{N: 1024, R: 1, P: 1}
+	values, err := parseParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range values {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid scrypt parameter %s: %s", key, err.Error())
+		}
+		switch key {
+		case "N":
+			h.N = n
+		case "r":
+			h.R = n
+		case "p":
+			h.P = n
+		default:
+			return nil, fmt.Errorf("Unknown scrypt parameter %q, must be one of N, r or p", key)
+		}
+	}
+
+	// Check the parameters now so Hash never has to fail. scrypt divides by r and p before checking them.
+	if h.R < 1 || h.P < 1 {
+		return nil, fmt.Errorf("Invalid scrypt parameters: r and p must be at least 1")
+	}
+	_, err = scrypt.Key(nil, nil, h.N, h.R, h.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid scrypt parameters: %s", err.Error())
+	}
+	return h, nil
+}
+
+// newArgon2Hasher builds an Argon2Hasher from params such as "time=1,memory=4096,threads=1"
+func newArgon2Hasher(params string) (*Argon2Hasher, error) {
+	h := &Argon2Hasher{Time: 1, Memory: 4096, Threads: 1}
+	values, err := parseParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range values {
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid argon2id parameter %s: %s", key, err.Error())
+		}
+		switch key {
+		case "time":
+			h.Time = uint32(n)
+		case "memory":
+			h.Memory = uint32(n)
+		case "threads":
+			if n > 255 {
+				return nil, fmt.Errorf("Invalid argon2id parameter threads: must be at most 255")
+			}
+			h.Threads = uint8(n)
+		default:
+			return nil, fmt.Errorf("Unknown argon2id parameter %q, must be one of time, memory or threads", key)
+		}
+	}
+
+	if h.Time < 1 || h.Threads < 1 {
+		return nil, fmt.Errorf("Invalid argon2id parameters: time and threads must be at least 1")
+	} else if h.Memory < 8*uint32(h.Threads) {
+		return nil, fmt.Errorf("Invalid argon2id parameters: memory must be at least 8 KiB per thread")
+	}
+	return h, nil
+}
+
+// parseParams splits a comma separated list of key=value pairs
+func parseParams(params string) (map[string]string, error) {
+	values := make(map[string]string)
+	if len(params) == 0 {
+		return values, nil
+	}
+
+	for _, pair := range strings.Split(params, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 {
+			return nil, fmt.Errorf("Invalid parameter %q, must be of the form key=value", pair)
+		}
+		values[kv[0]] = kv[1]
+	}
+	return values, nil
+}
+
+// Name returns SCRYPT
+func (h *ScryptHasher) Name() string {
+	return SCRYPT
+}
+
+// Params returns the cost parameters in the form accepted by NewHasher
+func (h *ScryptHasher) Params() string {
+	return fmt.Sprintf("N=%d,r=%d,p=%d", h.N, h.R, h.P)
+}
+
+// Hash appends the 32 byte scrypt key derived from data to dst. It panics if the parameters are invalid, which
+// NewHasher checks, as an empty digest would otherwise compare lowest of all.
+func (h *ScryptHasher) Hash(dst []byte, data []byte) []byte {
+	key, err := scrypt.Key(data, data, h.N, h.R, h.P, 32)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid scrypt parameters %s: %s", h.Params(), err.Error()))
+	}
+	return append(dst, key...)
+}
+
+// Name returns ARGON2ID
+func (h *Argon2Hasher) Name() string {
+	return ARGON2ID
+}
+
+// Params returns the cost parameters in the form accepted by NewHasher
+func (h *Argon2Hasher) Params() string {
+	return fmt.Sprintf("time=%d,memory=%d,threads=%d", h.Time, h.Memory, h.Threads)
+}
+
+// Hash appends the 32 byte Argon2id key derived from data to dst
+func (h *Argon2Hasher) Hash(dst []byte, data []byte) []byte {
+	return append(dst, argon2.IDKey(data, data, h.Time, h.Memory, h.Threads, 32)...)
+}
@@ -0,0 +1,74 @@
+package nonce
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScryptInvalidParamsPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(r.(string), "Invalid scrypt parameters") {
+			t.Errorf("Hash with N=3 recovered %v, want a panic naming the parameters", r)
+		}
+	}()
+	h := &ScryptHasher{N: 3, R: 1, P: 1}
+	t.Errorf("Hash with N=3 = %x, want a panic", h.Hash(nil, []byte("block")))
+}
+
+func TestMemoryHardHashers(t *testing.T) {
+	testHashers(t, []hasherTest{
+		// RFC 7914's first scrypt vector has an empty password and salt, so is the hash of empty data. Its 64 byte
+		// key starts with the 32 byte one.
+		{SCRYPT, "N=16,r=1,p=1", "", "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442"},
+		{SCRYPT, "", "COMSM0010cloud", "28bec7495a2263df7e8e7eef2d93c8ed2c6d51d23461ce51bdfa066ec08e83a4"},
+		// Argon2id vectors of an implementation of RFC 9106 which reproduces the RFC's own
+		{ARGON2ID, "", "block", "3437dbb2ad12b58af4a14492187128bda3270bd1e1b2166a1103c1c1ee625e86"},
+		{ARGON2ID, "time=1,memory=64,threads=1", "COMSM0010cloud", "51dbe69dc40a37c99826496f6ab605467a10858d6bc8d7d4eb2d9fa83869b6b6"},
+		{ARGON2ID, "time=2,memory=32,threads=2", "COMSM0010cloud", "81596f559952e612b95c9cf187bdc44e59a1327f1146740385784ea9a5203946"},
+	})
+}
+
+func TestMemoryHardParams(t *testing.T) {
+	tests := []struct {
+		algo   string
+		params string
+		// want is what Params gives back, or empty if NewHasher should fail
+		want string
+	}{
+		{SCRYPT, "", "N=1024,r=1,p=1"},
+		{SCRYPT, "N=2048, r=2", "N=2048,r=2,p=1"},
+		{SCRYPT, "p=3,N=16,r=8", "N=16,r=8,p=3"},
+		{SCRYPT, "N=3", ""},
+		{SCRYPT, "N=1", ""},
+		{SCRYPT, "N=x", ""},
+		{SCRYPT, "r=0", ""},
+		{SCRYPT, "p=0", ""},
+		{SCRYPT, "q=1", ""},
+		{SCRYPT, "N", ""},
+		{SCRYPT, "=1024", ""},
+		{SCRYPT, "N=1024,", ""},
+		{ARGON2ID, "", "time=1,memory=4096,threads=1"},
+		{ARGON2ID, "memory=64,threads=4", "time=1,memory=64,threads=4"},
+		{ARGON2ID, "time=0", ""},
+		{ARGON2ID, "threads=0", ""},
+		{ARGON2ID, "threads=256", ""},
+		{ARGON2ID, "memory=8,threads=2", ""},
+		{ARGON2ID, "memory=-1", ""},
+		{ARGON2ID, "iterations=1", ""},
+		{ARGON2ID, "time", ""},
+	}
+	for _, test := range tests {
+		h, err := NewHasher(test.algo, test.params)
+		if len(test.want) == 0 {
+			if err == nil {
+				t.Errorf("NewHasher(%q, %q) succeeded, want an error", test.algo, test.params)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewHasher(%q, %q): %v", test.algo, test.params, err)
+		} else if got := h.(interface{ Params() string }).Params(); got != test.want {
+			t.Errorf("NewHasher(%q, %q).Params() = %q, want %q", test.algo, test.params, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package nonce
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"io"
+)
+
+// Midstate is the saved state of a hash after absorbing a fixed prefix, so that hashing the prefix followed by
+// each nonce only has to process the final partial chunk of the prefix
+type Midstate interface {
+	// Hash appends the digest of the prefix followed by suffix to dst
+	Hash(dst []byte, suffix []byte) []byte
+	// Clone returns an independent copy for use by another goroutine, as a Midstate isn't safe for concurrent use
+	Clone() Midstate
+}
+
+// batchMidstate is a Midstate which can hash several suffixes at once
+type batchMidstate interface {
+	Midstate
+	// batchSize is how many suffixes hashBatch takes at most
+	batchSize() int
+	// hashBatch writes the digest of the prefix followed by each suffix into the matching digest buffer
+	hashBatch(digests [][]byte, suffixes [][]byte)
+}
+
+// MidstateHasher is implemented by hashers which can precompute a Midstate
+type MidstateHasher interface {
+	Hasher
+	Midstate(prefix []byte) Midstate
+}
+
+// stateDigest is a hash whose internal state can be saved and restored
+type stateDigest interface {
+	io.Writer
+	Sum(b []byte) []byte
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// sha256Midstate restores the SHA-256 state after the prefix's full 64 byte chunks for every nonce, and is used
+// when the CPU has none of the features the fast backends need
+type sha256Midstate struct {
+	state  []byte
+	digest stateDigest
+	double bool
+}
+
+func newStdlibSHA256Midstate(prefix []byte, double bool) Midstate {
+	digest := sha256.New().(stateDigest)
+	digest.Write(prefix)
+
+	// The marshalled state includes the unprocessed remainder of the prefix
+	state, err := digest.MarshalBinary()
+	if err != nil {
+		return nil
+	}
+	return &sha256Midstate{state, digest, double}
+}
+
+// Midstate absorbs the prefix once for reuse across nonces
+func (sha256dHasher) Midstate(prefix []byte) Midstate {
+	return newSHA256Midstate(prefix, true)
+}
+
+// Midstate absorbs the prefix once for reuse across nonces
+func (sha256Hasher) Midstate(prefix []byte) Midstate {
+	return newSHA256Midstate(prefix, false)
+}
+
+func (m *sha256Midstate) Hash(dst []byte, suffix []byte) []byte {
+	// The state came from the same kind of digest, so restoring it can't fail
+	m.digest.UnmarshalBinary(m.state)
+	m.digest.Write(suffix)
+	dst = m.digest.Sum(dst)
+	if !m.double {
+		return dst
+	}
+
+	start := len(dst) - sha256.Size
+	secondHash := sha256.Sum256(dst[start:])
+	return append(dst[:start], secondHash[:]...)
+}
+
+func (m *sha256Midstate) Clone() Midstate {
+	return &sha256Midstate{m.state, sha256.New().(stateDigest), m.double}
+}
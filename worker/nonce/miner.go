@@ -0,0 +1,177 @@
+package nonce
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// hashCounterOpts describes the counter a Miner registers with WithMetrics
+var hashCounterOpts = prometheus.CounterOpts{
+	Name: "nonce_hashes_total",
+	Help: "The total number of nonces hashed",
+}
+
+// Miner searches for golden nonces with a fixed set of options, for services embedding the search. Its methods are
+// safe for concurrent use, as long as any progress sink is too.
+type Miner struct {
+	config WorkerConfig
+}
+
+// Option configures a Miner
+type Option func(*Miner) error
+
+// NewMiner builds a Miner from opts, which must include a target, pattern or header. By default the nonce is
+// appended to the contents as 4 bytes big-endian, hashed with double SHA-256, and searched across every CPU.
+func NewMiner(opts ...Option) (*Miner, error) {
+	m := &Miner{}
+	for _, opt := range opts {
+		if err := opt(m); err != nil {
+			return nil, err
+		}
+	}
+	if m.config.Target.IsZero() && m.config.Pattern == nil && m.config.Header == nil {
+		return nil, errors.New("Invalid miner, must have a target, pattern or header")
+	}
+	return m, nil
+}
+
+// WithContents sets the block the nonce is written into, appended unless it contains a {nonce} placeholder
+func WithContents(contents string) Option {
+	return func(m *Miner) error {
+		m.config.Contents = contents
+		return nil
+	}
+}
+
+// WithEncoding sets how the nonce is written into the contents. A binary encoding without a width takes 4 bytes.
+func WithEncoding(encoding Encoding) Option {
+	return func(m *Miner) error {
+		encoding = encoding.withDefaults()
+		if err := encoding.validate(); err != nil {
+			return err
+		}
+		m.config.Encoding = encoding
+		return nil
+	}
+}
+
+// WithHeader switches to mining a Bitcoin block header, whose own target replaces any other
+func WithHeader(header *BlockHeader) Option {
+	return func(m *Miner) error {
+		m.config.Header = header
+		return nil
+	}
+}
+
+// WithExtraNonce sets the extra nonce every search is made with
+func WithExtraNonce(extraNonce uint32) Option {
+	return func(m *Miner) error {
+		m.config.ExtraNonce = extraNonce
+		return nil
+	}
+}
+
+// WithHasher sets the hash function, which defaults to double SHA-256
+func WithHasher(hasher Hasher) Option {
+	return func(m *Miner) error {
+		if hasher == nil {
+			return errors.New("Invalid hasher, must not be nil")
+		}
+		m.config.Hasher = hasher
+		return nil
+	}
+}
+
+// WithTarget sets the target golden hashes must be below
+func WithTarget(target Target) Option {
+	return func(m *Miner) error {
+		m.config.Target = target
+		return nil
+	}
+}
+
+// WithPattern searches for hashes whose hex digest matches pattern, rather than for hashes below a target
+func WithPattern(pattern *Pattern) Option {
+	return func(m *Miner) error {
+		m.config.Pattern = pattern
+		return nil
+	}
+}
+
+// WithThreads sets how many goroutines each search is split across, which defaults to the number of CPUs
+func WithThreads(threads int) Option {
+	return func(m *Miner) error {
+		if threads < 1 {
+			return errors.New("Invalid threads, must be at least 1")
+		}
+		m.config.Threads = threads
+		return nil
+	}
+}
+
+// WithOrder sets the order each search visits its range in
+func WithOrder(order Order) Option {
+	return func(m *Miner) error {
+		m.config.Order = order
+		return nil
+	}
+}
+
+// WithProgress has sink called every interval hashes of a search, or every 2^20 if interval is 0.
+// Concurrent searches share the sink.
+func WithProgress(sink func(Progress), interval uint64) Option {
+	return func(m *Miner) error {
+		m.config.Progress = sink
+		m.config.ProgressInterval = interval
+		return nil
+	}
+}
+
+// WithProgressPeriod has sink called every period of a search rather than every so many hashes, so slow hashers
+// report as often as fast ones. Concurrent searches share the sink.
+func WithProgressPeriod(sink func(Progress), period time.Duration) Option {
+	return func(m *Miner) error {
+		if period <= 0 {
+			return errors.New("Invalid progress period, must be greater than 0")
+		}
+		m.config.Progress = sink
+		m.config.ProgressPeriod = period
+		return nil
+	}
+}
+
+// WithMetrics counts the nonces hashed in nonce_hashes_total, registered with registry. Miners sharing a registry
+// share the counter.
+func WithMetrics(registry prometheus.Registerer) Option {
+	return func(m *Miner) error {
+		counter := prometheus.NewCounter(hashCounterOpts)
+		if err := registry.Register(counter); err != nil {
+			are, ok := err.(prometheus.AlreadyRegisteredError)
+			if !ok {
+				return err
+			}
+			if counter, ok = are.ExistingCollector.(prometheus.Counter); !ok {
+				return err
+			}
+		}
+		m.config.HashCounter = counter
+		return nil
+	}
+}
+
+// Search looks for a golden nonce in r, returning a NoNonceFoundError if there isn't one or a SearchCancelledError
+// if ctx is done first
+func (m *Miner) Search(ctx context.Context, r Range) (*GoldenNonce, error) {
+	config := m.config
+	config.LowerBound, config.UpperBound = r.Start, r.End
+	return CalculateGoldenNonceContext(ctx, &config)
+}
+
+// Verify recomputes the hash for nonce, returning it along with whether it's golden
+func (m *Miner) Verify(nonce uint32) (string, bool) {
+	config := m.config
+	return VerifyConfig(&config, nonce)
+}
@@ -0,0 +1,71 @@
+package nonce
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMinerSearchVerify(t *testing.T) {
+	m, err := NewMiner(WithContents(verifyContents), WithTarget(TargetFromLeadingZeros(12)), WithThreads(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gn, err := m.Search(context.Background(), Range{Start: 0, End: NonceSpace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash, ok := m.Verify(gn.Nonce); !ok || hash != gn.Hash {
+		t.Errorf("Miner.Verify(%d) = %s, %t, want %s, true", gn.Nonce, hash, ok, gn.Hash)
+	}
+	if hash, ok := Verify(verifyContents, gn.Nonce, TargetFromLeadingZeros(12)); !ok || hash != gn.Hash {
+		t.Errorf("Verify(%d) = %s, %t, want %s, true", gn.Nonce, hash, ok, gn.Hash)
+	}
+	if hash, ok := m.Verify(gn.Nonce ^ 1); ok || hash == gn.Hash {
+		t.Errorf("Miner.Verify(%d), tampered from %d, = %s, %t, want another hash which isn't golden", gn.Nonce^1, gn.Nonce, hash, ok)
+	}
+}
+
+func TestMinerSearchErrors(t *testing.T) {
+	m, _ := NewMiner(WithContents(verifyContents), WithTarget(TargetFromLeadingZeros(64)), WithThreads(1))
+
+	_, err := m.Search(context.Background(), Range{Start: 100, End: 200})
+	var notFound *NoNonceFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("Search of an impossible target = %v, want a NoNonceFoundError", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = m.Search(ctx, Range{Start: 0, End: NonceSpace})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Search with a cancelled context = %v, want it cancelled", err)
+	}
+}
+
+func TestNewMinerInvalidOptions(t *testing.T) {
+	target := WithTarget(TargetFromLeadingZeros(8))
+	sink := func(Progress) {}
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"no target", []Option{WithContents(verifyContents)}},
+		{"no threads", []Option{target, WithThreads(0)}},
+		{"negative threads", []Option{target, WithThreads(-1)}},
+		{"nil hasher", []Option{target, WithHasher(nil)}},
+		{"no progress period", []Option{target, WithProgressPeriod(sink, 0)}},
+		{"negative progress period", []Option{target, WithProgressPeriod(sink, -time.Second)}},
+		{"invalid encoding width", []Option{target, WithEncoding(Encoding{Format: BigEndian, Width: 3})}},
+	}
+	for _, test := range tests {
+		if m, err := NewMiner(test.opts...); err == nil {
+			t.Errorf("%s: NewMiner = %+v, want an error", test.name, m)
+		}
+	}
+
+	if _, err := NewMiner(target); err != nil {
+		t.Errorf("NewMiner with only a target: %v", err)
+	}
+}
@@ -1,94 +1,318 @@
 package nonce
 
 import (
-	"bytes"
-	"crypto/sha256"
-	"encoding/binary"
+	"context"
 	"encoding/hex"
 	"fmt"
+	"math/bits"
+	"runtime"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-// GoldenNonce computed from nonce appended to input string
+// GoldenNonce computed from nonce placed in the input string.
+// In header mode Hash is byte-reversed, as Bitcoin displays block hashes.
 type GoldenNonce struct {
-	Nonce uint32
-	Hash  string
+	Nonce      uint32 `json:"nonce"`
+	ExtraNonce uint32 `json:"extraNonce"`
+	Hash       string `json:"hash"`
 }
 
+// NonceSpace is the number of 32-bit nonces, so an UpperBound of NonceSpace searches up to and including the last
+const NonceSpace uint64 = 1 << 32
+
 // WorkerConfig provides the necessary parameters to compute a golden nonce
 type WorkerConfig struct {
-	Contents   string
+	Contents string
+	// LowerBound and UpperBound are the range [LowerBound, UpperBound) searched, with UpperBound at most NonceSpace
 	LowerBound uint32
-	UpperBound uint32
-	Target     int
-	DebugDesc  string
+	UpperBound uint64
+	Target     Target
+	// ExtraNonce extends the search beyond the 32-bit nonce space. When non-zero it is written just before the
+	// nonce in the same encoding padded to its full width, or rolled into the header as BlockHeader.Rolled does.
+	// Zero leaves the block unchanged.
+	ExtraNonce uint32
+	// Encoding is how the nonce is written into Contents, defaulting to 4 bytes big-endian
+	Encoding Encoding
+	// Pattern, if set, replaces Target: golden hashes are those whose hex digest matches it
+	Pattern *Pattern
+	// Header, if set, switches to Bitcoin header mode: Contents, Target, Encoding and Pattern are ignored, and the nonce is
+	// placed little-endian at the end of the serialised header, with the hash compared against Header.Target()
+	Header *BlockHeader
+	// Hasher computes the digest of each candidate, defaulting to double SHA-256
+	Hasher Hasher
+	// Threads is the number of goroutines the range is split across, defaulting to runtime.NumCPU()
+	Threads int
+	// Order is the order the range's nonces are visited in, defaulting to Sequential
+	Order Order
+	// Progress, if set, is called every ProgressInterval hashes with the state of the search, or every
+	// ProgressPeriod if that is set, which suits hashers of any cost
+	Progress         func(Progress)
+	ProgressInterval uint64
+	ProgressPeriod   time.Duration
+	// Cursor, if set, resumes a previous search from its checkpoint rather than from LowerBound
+	Cursor *Cursor
+	// HashCounter, if set, counts every nonce hashed
+	HashCounter prometheus.Counter
 }
 
 // NoNonceFoundError is thrown when a nonce cannot be found
 type NoNonceFoundError struct {
-	err string
+	err     string
+	Partial *PartialResult
+}
+
+// SearchCancelledError is returned when a search is stopped by its context before it completes
+type SearchCancelledError struct {
+	err     error
+	Partial *PartialResult
 }
 
-var (
-	opsProcessed = promauto.NewCounter(prometheus.CounterOpts{
-		Name: "worker_processed_ops_total",
-		Help: "The total number of processed nonces",
-	})
+// cancelCheckInterval is how many nonces are hashed between checks of the context, and memoryHardCheckInterval
+// is how many with a memory-hard hasher, taking about as long as cancelCheckInterval double SHA-256 hashes
+const (
+	cancelCheckInterval     = 1 << 10
+	memoryHardCheckInterval = 1
 )
 
 func (e *NoNonceFoundError) Error() string {
 	return fmt.Sprintf("Couldn't find nonce: %s", e.err)
 }
 
-func hash(block string, nonce uint32) ([]byte, error) {
-	// Convert the nonce to a byte[]
-	buf := new(bytes.Buffer)
-	err := binary.Write(buf, binary.BigEndian, nonce)
-	if err != nil {
-		return nil, err
+func (e *SearchCancelledError) Error() string {
+	return fmt.Sprintf("Search cancelled: %s", e.err.Error())
+}
+
+// Unwrap returns the context error that caused the cancellation
+func (e *SearchCancelledError) Unwrap() error {
+	return e.err
+}
+
+// candidate hashes each nonce of a search into reusable buffers, so that the search loop doesn't allocate.
+// It isn't safe for concurrent use, so each goroutine has its own.
+type candidate struct {
+	state    *searchState
+	midstate Midstate
+	// payload is the search prefix followed by the encoded nonce and the suffix
+	payload []byte
+	digest  []byte
+	// Header mode reverses the digest
+	reverse bool
+	// best is the lowest hash this candidate has produced
+	best found
+	// batch hashes several nonces at once, if the midstate can. It holds the nonces and digests of the positions
+	// from batchStart on, along with the encoded nonce and suffix each was hashed with.
+	batch         batchMidstate
+	batchStart    uint32
+	batchNonces   []uint32
+	batchDigests  [][]byte
+	batchSuffixes [][]byte
+}
+
+func newCandidate(state *searchState) *candidate {
+	size := len(state.prefix) + state.encoding.maxLen() + len(state.suffix)
+	c := &candidate{
+		state:   state,
+		payload: append(make([]byte, 0, size), state.prefix...),
+		digest:  make([]byte, 0, 64),
+		reverse: state.header != nil,
+		best:    found{digest: make([]byte, 0, 64)},
+	}
+	if state.midstate != nil {
+		c.midstate = state.midstate.Clone()
+	}
+	if b, ok := c.midstate.(batchMidstate); ok && b.batchSize() > 1 {
+		c.batch = b
+		c.batchNonces = make([]uint32, 0, b.batchSize())
+		c.batchDigests = make([][]byte, b.batchSize())
+		c.batchSuffixes = make([][]byte, b.batchSize())
+		for i := range c.batchDigests {
+			c.batchDigests[i] = make([]byte, 0, 64)
+			c.batchSuffixes[i] = make([]byte, 0, state.encoding.maxLen()+len(state.suffix))
+		}
+	}
+	return c
+}
+
+// hashAt returns the nonce the search's order puts at position along with its hash, hashing the following
+// positions before end in the same batch if the midstate can. The hash is only valid until the next call.
+func (c *candidate) hashAt(position uint32, end uint64) (uint32, []byte) {
+	if c.batch == nil {
+		n := c.state.ordering.nonce(position)
+		return n, c.hash(n)
+	}
+	if i := position - c.batchStart; position >= c.batchStart && i < uint32(len(c.batchNonces)) {
+		return c.batchNonces[i], c.batchDigests[i]
 	}
 
-	blockBytes := []byte(block)
-	bytes := append(blockBytes, buf.Bytes()...)
+	count := uint32(cap(c.batchNonces))
+	if end-uint64(position) < uint64(count) {
+		count = uint32(end - uint64(position))
+	}
+	c.batchStart = position
+	c.batchNonces = c.batchNonces[:count]
+	for i := range c.batchNonces {
+		n := c.state.ordering.nonce(position + uint32(i))
+		c.batchNonces[i] = n
+		c.batchSuffixes[i] = append(c.state.encoding.Append(c.batchSuffixes[i][:0], n), c.state.suffix...)
+	}
+	c.batch.hashBatch(c.batchDigests[:count], c.batchSuffixes[:count])
+	if c.reverse {
+		for _, digest := range c.batchDigests[:count] {
+			reverse(digest)
+		}
+	}
+	return c.batchNonces[0], c.batchDigests[0]
+}
 
-	// Complete one or two hashes
-	firstHash := sha256.Sum256(bytes)
-	secondHash := sha256.Sum256(firstHash[:])
-	return secondHash[:], nil
+// hash computes the hash which is compared against the target for nonce, finishing from the midstate when
+// there is one. The result is only valid until the next call.
+func (c *candidate) hash(nonce uint32) []byte {
+	prefixLen := len(c.state.prefix)
+	c.payload = append(c.state.encoding.Append(c.payload[:prefixLen], nonce), c.state.suffix...)
+	if c.midstate != nil {
+		c.digest = c.midstate.Hash(c.digest[:0], c.payload[prefixLen:])
+	} else {
+		c.digest = c.state.hasher.Hash(c.digest[:0], c.payload)
+	}
+
+	if c.reverse {
+		reverse(c.digest)
+	}
+	return c.digest
 }
 
 func leadingZeros(arr []byte) int {
-	leadingZeros := 0
+	for i, b := range arr {
+		if b != 0 {
+			return i*8 + bits.LeadingZeros8(b)
+		}
+	}
+	return len(arr) * 8
+}
+
+// splitRange divides [lower, upper) into at most n contiguous, non-empty sub-ranges, keeping within NonceSpace
+func splitRange(lower uint32, upper uint64, n int) []Range {
+	if upper > NonceSpace {
+		upper = NonceSpace
+	}
+	if upper <= uint64(lower) {
+		return nil
+	}
+	size := upper - uint64(lower)
+	if uint64(n) > size {
+		n = int(size)
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	ranges := make([]Range, 0, n)
+	split := size / uint64(n)
+	for i := uint64(0); i < uint64(n); i++ {
+		start := uint64(lower) + i*split
+		end := start + split
+		if i == uint64(n)-1 {
+			end = upper
+		}
+		ranges = append(ranges, Range{uint32(start), end})
+	}
+	return ranges
+}
+
+// initialRanges resumes from config's checkpoint if there is one, otherwise it splits the positions of the whole
+// range, or of this worker's share of it, between config.Threads goroutines
+func initialRanges(config *WorkerConfig) []Range {
+	if config.Cursor != nil {
+		return config.Cursor.remaining()
+	}
+
+	threads := config.Threads
+	if threads <= 0 {
+		threads = runtime.NumCPU()
+	}
+	lower, upper := config.Order.positions(config.LowerBound, config.UpperBound)
+	return splitRange(lower, upper, threads)
+}
+
+// searchRange looks for a golden nonce at the positions in state.ranges[idx], giving up once ctx is done
+func searchRange(ctx context.Context, state *searchState, idx int) (*GoldenNonce, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 
-	for _, b := range arr {
-		for i := 7; i >= 0; i-- {
-			mask := byte(1 << uint(i))
-			if b&mask != 0 {
-				return leadingZeros
+	config := state.config
+	c := newCandidate(state)
+	r := state.ranges[idx]
+	count := uint64(0)
+	for p := uint64(r.Start); p < r.End; p++ {
+		i := uint32(p)
+		if count == state.checkInterval {
+			state.record(idx, i-1, count, &c.best)
+			count = 0
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
 			}
-			leadingZeros++
 		}
+
+		n, hash := c.hashAt(i, r.End)
+		count++
+		if c.best.lower(hash) {
+			c.best.set(n, hash)
+		}
+		if state.target.Met(hash) {
+			state.record(idx, i, count, &c.best)
+			return &GoldenNonce{n, config.ExtraNonce, hex.EncodeToString(hash)}, nil
+		}
+	}
+	if count > 0 {
+		state.record(idx, uint32(r.End-1), count, &c.best)
 	}
-	return leadingZeros
+	return nil, nil
 }
 
-// CalculateGoldenNonce computes golden nonce for the string concatenated with all nonces in range [start, end)
+// CalculateGoldenNonce computes golden nonce for the string concatenated with all nonces in range [start, end).
+// The range is searched in parallel by config.Threads goroutines, returning the first golden nonce any of them finds.
 func CalculateGoldenNonce(config *WorkerConfig) (*GoldenNonce, error) {
-	for i := config.LowerBound; i < config.UpperBound; i++ {
-		hash, err := hash(config.Contents, i)
-		if err != nil {
-			return nil, err
-		}
+	return CalculateGoldenNonceContext(context.Background(), config)
+}
+
+// CalculateGoldenNonceContext behaves like CalculateGoldenNonce, but stops early with a SearchCancelledError
+// once ctx is cancelled or its deadline passes
+func CalculateGoldenNonceContext(ctx context.Context, config *WorkerConfig) (*GoldenNonce, error) {
+	type result struct {
+		nonce *GoldenNonce
+		err   error
+	}
 
-		zeros := leadingZeros(hash)
-		go func() {
-			opsProcessed.Inc()
-		}()
-		if zeros >= config.Target {
-			return &GoldenNonce{i, hex.EncodeToString(hash)}, nil
+	ranges := initialRanges(config)
+	state, err := newSearchState(config, ranges)
+	if err != nil {
+		return nil, err
+	}
+	results := make(chan result, len(ranges))
+	// Signal any remaining goroutines to finish once we return
+	searchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for i := range ranges {
+		go func(idx int) {
+			n, err := searchRange(searchCtx, state, idx)
+			results <- result{n, err}
+		}(i)
+	}
+	for range ranges {
+		res := <-results
+		if res.err != nil {
+			if ctx.Err() != nil {
+				return nil, &SearchCancelledError{ctx.Err(), state.partial()}
+			}
+			return nil, res.err
+		}
+		if res.nonce != nil {
+			return res.nonce, nil
 		}
 	}
-	return nil, &NoNonceFoundError{fmt.Sprintf("No nonce found of length %d between %d and %d", config.Target, config.LowerBound, config.UpperBound)}
+	return nil, &NoNonceFoundError{fmt.Sprintf("No nonce found %s between %d and %d with extra nonce %d", state.goal(), config.LowerBound, config.UpperBound, config.ExtraNonce), state.partial()}
 }
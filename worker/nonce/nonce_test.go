@@ -0,0 +1,337 @@
+package nonce
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+var benchmarkBlockSizes = []struct {
+	name string
+	size int
+}{
+	{"1KB", 1 << 10},
+	{"64KB", 64 << 10},
+	{"1MB", 1 << 20},
+}
+
+// newBenchmarkCandidate hashes nonces appended to contents, rehashing all of contents each time unless midstate is set
+func newBenchmarkCandidate(contents string, encoding Encoding, midstate bool) *candidate {
+	state, _ := newSearchState(&WorkerConfig{Contents: contents, Encoding: encoding}, nil)
+	c := newCandidate(state)
+	if !midstate {
+		c.midstate = nil
+	}
+	return c
+}
+
+func BenchmarkHash(b *testing.B) {
+	b.ReportAllocs()
+	c := newBenchmarkCandidate("COMSM0010cloud", DefaultEncoding, false)
+	for i := 0; i < b.N; i++ {
+		c.hash(uint32(i))
+	}
+}
+
+// BenchmarkEncodedHash covers each nonce encoding, placed mid-payload by a template
+func BenchmarkEncodedHash(b *testing.B) {
+	for _, e := range []Encoding{{BigEndian, 8}, {LittleEndian, 4}, {Decimal, 0}, {Hex, 16}} {
+		c := newBenchmarkCandidate("COMSM0010{nonce}cloud", e, true)
+		b.Run(e.String(), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				c.hash(uint32(i))
+			}
+		})
+	}
+}
+
+func BenchmarkLeadingZeros(b *testing.B) {
+	b.ReportAllocs()
+	digest := TargetFromLeadingZeros(20)
+	for i := 0; i < b.N; i++ {
+		leadingZeros(digest[:])
+	}
+}
+
+// BenchmarkFullHash rehashes the whole block for every nonce
+func BenchmarkFullHash(b *testing.B) {
+	for _, bs := range benchmarkBlockSizes {
+		c := newBenchmarkCandidate(strings.Repeat("x", bs.size), DefaultEncoding, false)
+		b.Run(bs.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				c.hash(uint32(i))
+			}
+		})
+	}
+}
+
+// BenchmarkMidstateHash absorbs the block once, then only finishes its final chunk for every nonce
+func BenchmarkMidstateHash(b *testing.B) {
+	for _, bs := range benchmarkBlockSizes {
+		midstate := sha256dHasher{}.Midstate([]byte(strings.Repeat("x", bs.size)))
+		b.Run(bs.name, func(b *testing.B) {
+			b.ReportAllocs()
+			suffix := make([]byte, 4)
+			digest := make([]byte, 0, 64)
+			for i := 0; i < b.N; i++ {
+				binary.BigEndian.PutUint32(suffix, uint32(i))
+				digest = midstate.Hash(digest[:0], suffix)
+			}
+		})
+	}
+}
+
+// BenchmarkSearch measures the whole search loop on a single goroutine, with a target which is never met
+func BenchmarkSearch(b *testing.B) {
+	b.ReportAllocs()
+	config := &WorkerConfig{
+		Contents:   "COMSM0010cloud",
+		UpperBound: uint64(b.N),
+		Target:     TargetFromLeadingZeros(256),
+		Threads:    1,
+	}
+	CalculateGoldenNonce(config)
+}
+
+func TestOrders(t *testing.T) {
+	ranges := []struct {
+		lower uint32
+		upper uint64
+	}{
+		{0, 1},
+		{0, 2},
+		{5, 8},
+		{0, 17},
+		{100, 201},
+		{1000, 1257},
+		{uint32(NonceSpace - 13), NonceSpace},
+	}
+	for _, kind := range []string{Sequential, Strided, Shuffled, RandomOffsets} {
+		for _, lanes := range []int{1, 2, 3, 7, 16} {
+			for _, r := range ranges {
+				order := Order{Kind: kind, Lanes: lanes, Seed: 42}
+				t.Run(fmt.Sprintf("%s/%d lanes/[%d,%d)", kind, lanes, r.lower, r.upper), func(t *testing.T) {
+					o := newOrdering(order, r.lower, r.upper)
+					seen := make(map[uint32]bool)
+					for p := uint64(r.lower); p < r.upper; p++ {
+						n := o.nonce(uint32(p))
+						if uint64(n) < uint64(r.lower) || uint64(n) >= r.upper {
+							t.Fatalf("Position %d maps to nonce %d, outside the range", p, n)
+						} else if seen[n] {
+							t.Fatalf("Nonce %d is visited twice", n)
+						}
+						seen[n] = true
+					}
+					if uint64(len(seen)) != r.upper-uint64(r.lower) {
+						t.Errorf("Visited %d nonces, want %d", len(seen), r.upper-uint64(r.lower))
+					}
+				})
+			}
+		}
+	}
+}
+
+// TestWorkerOrders checks that a range interleaved between workers has each of them visit every workers'th nonce
+// from its own, so that together they visit each nonce of the range exactly once
+func TestWorkerOrders(t *testing.T) {
+	ranges := []struct {
+		lower uint32
+		upper uint64
+	}{
+		{0, 2},
+		{5, 8},
+		{100, 201},
+		{uint32(NonceSpace - 13), NonceSpace},
+	}
+	for _, kind := range []string{Sequential, Strided, Shuffled, RandomOffsets} {
+		for _, workers := range []int{2, 3, 5} {
+			for _, r := range ranges {
+				seen := make(map[uint32]bool)
+				for worker := 0; worker < workers; worker++ {
+					order := Order{Kind: kind, Lanes: 3, Seed: 42, Worker: worker, Workers: workers}
+					o := newOrdering(order, r.lower, r.upper)
+					lower, end := order.positions(r.lower, r.upper)
+					for p := uint64(lower); p < end; p++ {
+						n := o.nonce(uint32(p))
+						if uint64(n) >= r.upper || n < r.lower || int(n-r.lower)%workers != worker {
+							t.Fatalf("%s: worker %d of %d maps position %d of [%d,%d) to nonce %d, outside its share", kind, worker, workers, p, r.lower, r.upper, n)
+						} else if seen[n] {
+							t.Fatalf("%s: nonce %d of [%d,%d) is visited twice by %d workers", kind, n, r.lower, r.upper, workers)
+						}
+						seen[n] = true
+					}
+				}
+				if uint64(len(seen)) != r.upper-uint64(r.lower) {
+					t.Errorf("%s: %d workers visited %d nonces of [%d,%d), want all of them", kind, workers, len(seen), r.lower, r.upper)
+				}
+			}
+		}
+	}
+}
+
+// TestOrderedSearch checks that each order's search, split across goroutines, hashes every nonce of the range
+func TestOrderedSearch(t *testing.T) {
+	for _, kind := range []string{Sequential, Strided, Shuffled, RandomOffsets} {
+		// A single search, or the searches of each of 4 workers it is interleaved between
+		for _, workers := range []int{1, 4} {
+			seen := make(map[uint32]bool)
+			hashes := uint64(0)
+			for worker := 0; worker < workers; worker++ {
+				e, err := EnumerateGoldenNonces(context.Background(), &WorkerConfig{
+					Contents:   "COMSM0010cloud",
+					LowerBound: 10,
+					UpperBound: 1011,
+					Target:     TargetFromLeadingZeros(0),
+					Threads:    3,
+					Order:      Order{Kind: kind, Worker: worker, Workers: workers},
+				}, 0)
+				if err != nil {
+					t.Fatalf("%s: %v", kind, err)
+				}
+				for _, n := range e.Nonces {
+					seen[n.Nonce] = true
+				}
+				hashes += e.Hashes
+			}
+			if hashes != 1001 || len(seen) != 1001 {
+				t.Errorf("%s across %d workers: hashed %d nonces, %d of them distinct, want 1001", kind, workers, hashes, len(seen))
+			}
+		}
+	}
+}
+
+func TestOrderSeed(t *testing.T) {
+	config := &WorkerConfig{Threads: 4, Order: Order{Kind: Shuffled}}
+	first, second := resolveOrder(config), resolveOrder(config)
+	if first.Seed == 0 || first.Seed == second.Seed {
+		t.Errorf("Unseeded orders have seeds %d and %d, want them random", first.Seed, second.Seed)
+	}
+
+	config.Order.Seed = 42
+	if order := resolveOrder(config); order.Seed != 42 || order.Lanes != 4 {
+		t.Errorf("resolveOrder = %+v, want the given seed and lanes from the threads", order)
+	}
+
+	// A resumed search keeps its checkpoint's seed
+	config.Cursor = &Cursor{Order: &Order{Kind: Shuffled, Lanes: 2, Seed: 7}}
+	if order := resolveOrder(config); order.Seed != 7 {
+		t.Errorf("Resumed order has seed %d, want 7", order.Seed)
+	}
+}
+
+func TestParseOrder(t *testing.T) {
+	tests := []struct {
+		input string
+		order Order
+		valid bool
+	}{
+		{"sequential", Order{Kind: Sequential}, true},
+		{"strided:8", Order{Kind: Strided, Lanes: 8}, true},
+		{"shuffled:0:42", Order{Kind: Shuffled, Seed: 42}, true},
+		{"random-offsets:4:18446744073709551615", Order{Kind: RandomOffsets, Lanes: 4, Seed: 1<<64 - 1}, true},
+		{"", Order{}, false},
+		{"backwards", Order{}, false},
+		{"strided:-1", Order{}, false},
+		{"strided:x", Order{}, false},
+		{"shuffled:0:x", Order{}, false},
+		{"shuffled:0:1:2", Order{}, false},
+		{"strided@2/5", Order{Kind: Strided, Worker: 2, Workers: 5}, true},
+		{"shuffled:4:42@0/3", Order{Kind: Shuffled, Lanes: 4, Seed: 42, Workers: 3}, true},
+		{"strided@5/5", Order{}, false},
+		{"strided@-1/5", Order{}, false},
+		{"strided@1", Order{}, false},
+		{"strided@x/2", Order{}, false},
+		{"strided@1/2/3", Order{}, false},
+	}
+	for _, test := range tests {
+		order, err := ParseOrder(test.input)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("ParseOrder(%q) = %+v, want an error", test.input, order)
+			}
+			continue
+		}
+		if err != nil || order != test.order {
+			t.Errorf("ParseOrder(%q) = %+v, %v, want %+v", test.input, order, err, test.order)
+		} else if order.String() != test.input {
+			t.Errorf("%+v.String() = %q, want %q", order, order.String(), test.input)
+		}
+	}
+}
+
+func TestEnumerateTooMany(t *testing.T) {
+	e, err := EnumerateGoldenNonces(context.Background(), &WorkerConfig{
+		Contents:   "COMSM0010cloud",
+		UpperBound: 4 * MaxEnumerated,
+		Target:     TargetFromLeadingZeros(0),
+		Threads:    4,
+	}, 0)
+	if err != ErrTooManyNonces {
+		t.Fatalf("Enumerating %d golden nonces = %v, want ErrTooManyNonces", 4*MaxEnumerated, err)
+	}
+	if len(e.Nonces) != MaxEnumerated {
+		t.Errorf("Kept %d nonces, want %d", len(e.Nonces), MaxEnumerated)
+	}
+
+	// The top k are kept however many nonces are golden
+	e, err = EnumerateGoldenNonces(context.Background(), &WorkerConfig{
+		Contents:   "COMSM0010cloud",
+		UpperBound: 2 * MaxEnumerated,
+		Target:     TargetFromLeadingZeros(0),
+	}, 10)
+	if err != nil || len(e.Nonces) != 10 {
+		t.Errorf("Enumerating the top 10 = %d nonces, %v, want 10", len(e.Nonces), err)
+	}
+}
+
+// unreachable is a target no hash meets, so a search only ends by running out of nonces or being cancelled
+var unreachable = TargetFromLeadingZeros(256)
+
+func TestSearchCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	timeout, cancelTimeout := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelTimeout()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		// progress cancels ctx partway through the search
+		progress func(Progress)
+		err      error
+	}{
+		{"cancelled", ctx, func(Progress) { cancel() }, context.Canceled},
+		{"deadline", timeout, nil, context.DeadlineExceeded},
+	}
+	for _, test := range tests {
+		_, err := CalculateGoldenNonceContext(test.ctx, &WorkerConfig{
+			Contents:         "COMSM0010cloud",
+			UpperBound:       NonceSpace,
+			Target:           unreachable,
+			Threads:          2,
+			Progress:         test.progress,
+			ProgressInterval: 1 << 12,
+		})
+
+		cancelled, ok := err.(*SearchCancelledError)
+		if !ok {
+			t.Fatalf("%s: error = %#v, want a *SearchCancelledError", test.name, err)
+		}
+		var notFound *NoNonceFoundError
+		if errors.As(err, &notFound) {
+			t.Errorf("%s: error %v is also a *NoNonceFoundError", test.name, err)
+		}
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: error %v doesn't unwrap to %v", test.name, err, test.err)
+		}
+		if p := cancelled.Partial; p == nil || p.Best == nil || p.Hashes == 0 || p.Hashes >= NonceSpace {
+			t.Errorf("%s: partial result = %+v, want the best of some of the nonces", test.name, p)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package nonce
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Names of the orders a range can be searched in
+const (
+	Sequential    string = "sequential"
+	Strided       string = "strided"
+	Shuffled      string = "shuffled"
+	RandomOffsets string = "random-offsets"
+)
+
+// feistelRounds is enough rounds for the shuffled order to look random, which is all it needs
+const feistelRounds = 4
+
+// Order is how a search visits the nonces of its range. Goroutines still split the range into contiguous blocks
+// of positions, and the order maps each position to the nonce hashed there, so every nonce is visited exactly once.
+// The zero Order is Sequential, where each position is its own nonce and the lowest golden nonce is found first.
+type Order struct {
+	Kind string `json:"kind"`
+	// Lanes is how many nonces apart a Strided order's goroutines interleave, or how many blocks RandomOffsets
+	// rotates, defaulting to the number of threads so that each goroutine has its own
+	Lanes int `json:"lanes,omitempty"`
+	// Seed keys the Shuffled permutation and the RandomOffsets rotations, chosen at random for each search if zero
+	Seed uint64 `json:"seed,omitempty"`
+	// Workers, if above 1, interleaves the range between that many workers rather than giving each a block of it.
+	// This search is Worker's share, counting from 0: every Workers'th nonce from the Worker'th, visited in the
+	// order Kind describes, so that a Strided order strides across workers as well as goroutines.
+	Worker  int `json:"worker,omitempty"`
+	Workers int `json:"workers,omitempty"`
+}
+
+// ParseOrder reads an order as String formats it, kind[:lanes[:seed]][@worker/workers]
+func ParseOrder(s string) (Order, error) {
+	var worker, workers int
+	if at := strings.Index(s, "@"); at >= 0 {
+		share := strings.Split(s[at+1:], "/")
+		var errWorker, errWorkers error
+		if len(share) == 2 {
+			worker, errWorker = strconv.Atoi(share[0])
+			workers, errWorkers = strconv.Atoi(share[1])
+		}
+		if len(share) != 2 || errWorker != nil || errWorkers != nil || worker < 0 || worker >= workers {
+			return Order{}, fmt.Errorf("Invalid order workers %s, must be worker/workers with worker below workers", s[at+1:])
+		}
+		s = s[:at]
+	}
+
+	fields := strings.Split(s, ":")
+	order := Order{Kind: fields[0]}
+	switch order.Kind {
+	case Sequential, Strided, Shuffled, RandomOffsets:
+	default:
+		return Order{}, fmt.Errorf("Unknown order %s, must be sequential, strided, shuffled or random-offsets", order.Kind)
+	}
+	if len(fields) > 3 {
+		return Order{}, fmt.Errorf("Invalid order %s, must be kind[:lanes[:seed]]", s)
+	}
+
+	if len(fields) > 1 {
+		lanes, err := strconv.Atoi(fields[1])
+		if err != nil || lanes < 0 {
+			return Order{}, fmt.Errorf("Invalid order lanes %s, must be at least 0", fields[1])
+		}
+		order.Lanes = lanes
+	}
+	if len(fields) > 2 {
+		seed, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return Order{}, fmt.Errorf("Invalid order seed %s", fields[2])
+		}
+		order.Seed = seed
+	}
+	order.Worker, order.Workers = worker, workers
+	return order, nil
+}
+
+// String formats the order as ParseOrder reads it, leaving off zero lanes and seed, and the workers unless the
+// range is interleaved between them
+func (o Order) String() string {
+	s := o.Kind
+	if len(s) == 0 {
+		s = Sequential
+	}
+	if o.Seed != 0 {
+		s = fmt.Sprintf("%s:%d:%d", s, o.Lanes, o.Seed)
+	} else if o.Lanes != 0 {
+		s = fmt.Sprintf("%s:%d", s, o.Lanes)
+	}
+	if o.Workers > 1 {
+		s = fmt.Sprintf("%s@%d/%d", s, o.Worker, o.Workers)
+	}
+	return s
+}
+
+// positions returns the positions [lower, end) searched for the range [lower, upper), which hold only the worker's
+// share of it if the range is interleaved between workers
+func (o Order) positions(lower uint32, upper uint64) (uint32, uint64) {
+	if upper > NonceSpace {
+		upper = NonceSpace
+	}
+	if o.Workers <= 1 || upper <= uint64(lower) {
+		return lower, upper
+	}
+	n, worker, workers := upper-uint64(lower), uint64(o.Worker), uint64(o.Workers)
+	if worker >= n {
+		return lower, uint64(lower)
+	}
+	return lower, uint64(lower) + (n-worker+workers-1)/workers
+}
+
+// ordering maps positions in [lower, upper) to nonces in the same range
+type ordering interface {
+	nonce(position uint32) uint32
+}
+
+// newOrdering builds the ordering of [lower, upper) that order describes, with Lanes already defaulted
+func newOrdering(order Order, lower uint32, upper uint64) ordering {
+	if order.Workers > 1 {
+		// Order the worker's share as if it were the whole range, then spread it out
+		_, end := order.positions(lower, upper)
+		share := order
+		share.Worker, share.Workers = 0, 0
+		return &workerOrder{lower, uint64(order.Worker), uint64(order.Workers), newOrdering(share, lower, end)}
+	}
+	if upper > NonceSpace {
+		upper = NonceSpace
+	}
+	if upper <= uint64(lower) {
+		return sequentialOrder{}
+	}
+	n := upper - uint64(lower)
+	lanes := uint64(order.Lanes)
+	if lanes > n {
+		lanes = n
+	}
+	if n <= 1 || lanes == 0 {
+		return sequentialOrder{}
+	}
+
+	switch order.Kind {
+	case Strided:
+		return &stridedOrder{lower: lower, lanes: lanes, size: n / lanes, long: n % lanes}
+	case Shuffled:
+		return newShuffledOrder(lower, n, order.Seed)
+	case RandomOffsets:
+		o := &offsetOrder{lower: lower, n: n, split: n / lanes, offsets: make([]uint64, lanes)}
+		for i := range o.offsets {
+			o.offsets[i] = splitmix64(order.Seed+uint64(i)) % o.partSize(uint64(i))
+		}
+		return o
+	default:
+		return sequentialOrder{}
+	}
+}
+
+// resolveOrder fills in the defaults of config's order, or takes the order from the checkpoint being resumed, which
+// keeps the seed chosen for it
+func resolveOrder(config *WorkerConfig) Order {
+	if config.Cursor != nil && config.Cursor.Order != nil {
+		return *config.Cursor.Order
+	}
+
+	order := config.Order
+	if len(order.Kind) == 0 {
+		order.Kind = Sequential
+	}
+	if order.Lanes <= 0 {
+		order.Lanes = config.Threads
+		if order.Lanes <= 0 {
+			order.Lanes = runtime.NumCPU()
+		}
+	}
+	if order.Seed == 0 && (order.Kind == Shuffled || order.Kind == RandomOffsets) {
+		order.Seed = randomSeed()
+	}
+	return order
+}
+
+// randomSeed returns a seed from crypto/rand, or from the clock if that fails
+func randomSeed() uint64 {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return uint64(time.Now().UnixNano())
+	}
+	return binary.LittleEndian.Uint64(buf[:])
+}
+
+type sequentialOrder struct{}
+
+func (sequentialOrder) nonce(position uint32) uint32 {
+	return position
+}
+
+// workerOrder maps the positions of a worker's share of an interleaved range, ordered by share as if they were the
+// first nonces of the range, to the nonces of that share
+type workerOrder struct {
+	lower   uint32
+	worker  uint64
+	workers uint64
+	share   ordering
+}
+
+func (o *workerOrder) nonce(position uint32) uint32 {
+	return o.lower + uint32(o.worker+o.workers*uint64(o.share.nonce(position)-o.lower))
+}
+
+// stridedOrder lays out the lanes one after another, each lane holding every lanes'th nonce. The first long lanes
+// hold one more nonce than the others.
+type stridedOrder struct {
+	lower uint32
+	lanes uint64
+	size  uint64
+	long  uint64
+}
+
+func (o *stridedOrder) nonce(position uint32) uint32 {
+	q := uint64(position - o.lower)
+	var lane, k uint64
+	if longSpan := o.long * (o.size + 1); q < longSpan {
+		lane, k = q/(o.size+1), q%(o.size+1)
+	} else {
+		lane, k = o.long+(q-longSpan)/o.size, (q-longSpan)%o.size
+	}
+	return o.lower + uint32(lane+k*o.lanes)
+}
+
+// shuffledOrder is a keyed Feistel permutation of the smallest power of 4 holding the range. Applying it again to
+// anything which lands outside the range, cycle walking, makes it a permutation of the range itself.
+type shuffledOrder struct {
+	lower uint32
+	n     uint64
+	half  uint
+	mask  uint64
+	keys  [feistelRounds]uint64
+}
+
+func newShuffledOrder(lower uint32, n uint64, seed uint64) *shuffledOrder {
+	width := uint(bits.Len64(n - 1))
+	if width%2 == 1 {
+		width++
+	}
+	o := &shuffledOrder{lower: lower, n: n, half: width / 2}
+	o.mask = 1<<o.half - 1
+	for i := range o.keys {
+		o.keys[i] = splitmix64(seed + uint64(i))
+	}
+	return o
+}
+
+func (o *shuffledOrder) nonce(position uint32) uint32 {
+	x := uint64(position - o.lower)
+	for {
+		x = o.permute(x)
+		if x < o.n {
+			return o.lower + uint32(x)
+		}
+	}
+}
+
+func (o *shuffledOrder) permute(x uint64) uint64 {
+	l, r := x>>o.half, x&o.mask
+	for _, key := range o.keys {
+		l, r = r, l^(splitmix64(r^key)&o.mask)
+	}
+	return l<<o.half | r
+}
+
+// offsetOrder splits the range into blocks as splitRange does, and starts each block at a pseudo-random offset,
+// wrapping around to its beginning
+type offsetOrder struct {
+	lower   uint32
+	n       uint64
+	split   uint64
+	offsets []uint64
+}
+
+// partSize is the length of block i, the last one taking any remainder
+func (o *offsetOrder) partSize(i uint64) uint64 {
+	if i == uint64(len(o.offsets))-1 {
+		return o.n - i*o.split
+	}
+	return o.split
+}
+
+func (o *offsetOrder) nonce(position uint32) uint32 {
+	q := uint64(position - o.lower)
+	i := q / o.split
+	if last := uint64(len(o.offsets)) - 1; i > last {
+		i = last
+	}
+	start := i * o.split
+	return o.lower + uint32(start+(q-start+o.offsets[i])%o.partSize(i))
+}
+
+// splitmix64 is the finaliser of the SplitMix64 generator, scrambling x into a well mixed value
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
@@ -0,0 +1,270 @@
+package nonce
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// Kinds of pattern, written before the pattern's value as in prefix:c0ffee
+const (
+	PrefixPattern string = "prefix"
+	SuffixPattern string = "suffix"
+	MaskPattern   string = "mask"
+	RegexPattern  string = "regex"
+)
+
+// digestHexLength is the length of a 256-bit hex digest, which regular expression probabilities are estimated for
+const digestHexLength = 64
+
+// Predicate decides whether a hash is golden
+type Predicate interface {
+	// Met reports whether hash is golden
+	Met(hash []byte) bool
+	// Probability is the chance of a uniformly random hash being golden
+	Probability() float64
+}
+
+// Pattern is a Predicate on the lowercase hex digest, used to search for vanity hashes
+type Pattern struct {
+	text string
+	// mask and value select the bits compared, aligned to the end of the digest if fromEnd is set
+	mask, value []byte
+	fromEnd     bool
+	re          *regexp.Regexp
+	probability float64
+}
+
+// ParsePattern reads a pattern in one of the forms
+//
+//	prefix:<hex>             digest starts with the hex digits
+//	suffix:<hex>             digest ends with the hex digits
+//	mask:<hex>/<hex>         digest ANDed with the mask equals the value, both aligned to the start of the digest
+//	regex:<expression>       hex digest matches the regular expression
+func ParsePattern(s string) (*Pattern, error) {
+	colon := strings.IndexByte(s, ':')
+	if colon < 0 {
+		return nil, fmt.Errorf("Invalid pattern %q, must be kind:value", s)
+	}
+	kind, value := s[:colon], s[colon+1:]
+	p := &Pattern{text: s}
+
+	switch kind {
+	case PrefixPattern, SuffixPattern:
+		mask, v, err := parseNibbles(value)
+		if err != nil {
+			return nil, err
+		}
+		p.mask, p.value, p.fromEnd = mask, v, kind == SuffixPattern
+		if p.fromEnd && len(value)%2 == 1 {
+			// Shift down a nibble, so the digits finish at the end of the last byte
+			p.mask, p.value = shiftNibble(p.mask), shiftNibble(p.value)
+		}
+		p.probability = math.Pow(16, -float64(len(value)))
+	case MaskPattern:
+		parts := strings.Split(value, "/")
+		if len(parts) != 2 || len(parts[0]) != len(parts[1]) {
+			return nil, fmt.Errorf("Invalid pattern %q, mask and value must be hex digits of the same length", s)
+		}
+		_, mask, err := parseNibbles(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		_, v, err := parseNibbles(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		bits := 0
+		for i := range mask {
+			if v[i]&^mask[i] != 0 {
+				return nil, fmt.Errorf("Invalid pattern %q, value has bits outside the mask", s)
+			}
+			bits += popcount(mask[i])
+		}
+		p.mask, p.value = mask, v
+		p.probability = math.Pow(2, -float64(bits))
+	case RegexPattern:
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pattern %q: %s", s, err)
+		}
+		parsed, err := syntax.Parse(value, syntax.Perl)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pattern %q: %s", s, err)
+		}
+		p.re = re
+		p.probability = regexProbability(parsed.Simplify())
+	default:
+		return nil, fmt.Errorf("Unknown pattern kind %q, must be prefix, suffix, mask or regex", kind)
+	}
+	return p, nil
+}
+
+// parseNibbles reads hex digits of any length, returning a mask of the bits they give along with the bytes they fill
+func parseNibbles(s string) ([]byte, []byte, error) {
+	if len(s) == 0 || len(s) > digestHexLength {
+		return nil, nil, fmt.Errorf("Invalid pattern hex %q, must be 1 to %d digits", s, digestHexLength)
+	}
+	padded := strings.ToLower(s)
+	if len(padded)%2 == 1 {
+		padded += "0"
+	}
+	value, err := hex.DecodeString(padded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid pattern hex %q", s)
+	}
+
+	mask := make([]byte, len(value))
+	for i := range mask {
+		mask[i] = 0xff
+	}
+	if len(s)%2 == 1 {
+		mask[len(mask)-1] = 0xf0
+	}
+	return mask, value, nil
+}
+
+// shiftNibble moves every nibble of b one place towards the end, dropping the last
+func shiftNibble(b []byte) []byte {
+	shifted := make([]byte, len(b))
+	for i := range b {
+		shifted[i] = b[i] >> 4
+		if i > 0 {
+			shifted[i] |= b[i-1] << 4
+		}
+	}
+	return shifted
+}
+
+func popcount(b byte) int {
+	n := 0
+	for ; b != 0; b &= b - 1 {
+		n++
+	}
+	return n
+}
+
+// Met reports whether the hex digest of hash matches the pattern
+func (p *Pattern) Met(hash []byte) bool {
+	if p.re != nil {
+		var buf [2 * digestHexLength]byte
+		text := buf[:0]
+		if 2*len(hash) > len(buf) {
+			text = make([]byte, 0, 2*len(hash))
+		}
+		text = text[:2*len(hash)]
+		hex.Encode(text, hash)
+		return p.re.Match(text)
+	}
+
+	if len(p.mask) > len(hash) {
+		return false
+	}
+	offset := 0
+	if p.fromEnd {
+		offset = len(hash) - len(p.mask)
+	}
+	for i, m := range p.mask {
+		if hash[offset+i]&m != p.value[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Probability is the chance of a uniformly random hash matching. Regular expressions are estimated from the
+// entropy of the hex digits they constrain, assuming a 256-bit digest.
+func (p *Pattern) Probability() float64 {
+	return p.probability
+}
+
+// String gives the pattern in the form accepted by ParsePattern
+func (p *Pattern) String() string {
+	return p.text
+}
+
+// regexProbability estimates the chance of a random hex digest matching re, from the chance of each position
+// matching at one place multiplied by the number of places it could match at
+func regexProbability(re *syntax.Regexp) float64 {
+	p, length := matchProbability(re)
+	positions := 1
+	if !anchored(re) && length < digestHexLength {
+		positions = digestHexLength - length + 1
+	}
+	return math.Min(1, p*float64(positions))
+}
+
+// anchored reports whether re can only match at one place, as it starts with ^ or ends with $
+func anchored(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpBeginText, syntax.OpBeginLine, syntax.OpEndText, syntax.OpEndLine:
+		return true
+	case syntax.OpCapture:
+		return anchored(re.Sub[0])
+	case syntax.OpConcat:
+		return len(re.Sub) > 0 && (anchored(re.Sub[0]) || anchored(re.Sub[len(re.Sub)-1]))
+	}
+	return false
+}
+
+// matchProbability estimates the chance of random hex digits matching re at a given place, along with the least
+// number of digits a match takes. Optional parts are assumed to be skipped.
+func matchProbability(re *syntax.Regexp) (float64, int) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		p := 1.0
+		for _, r := range re.Rune {
+			p *= hexFraction([]rune{r, r}, re.Flags&syntax.FoldCase != 0)
+		}
+		return p, len(re.Rune)
+	case syntax.OpCharClass:
+		return hexFraction(re.Rune, false), 1
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return 1, 1
+	case syntax.OpCapture, syntax.OpPlus:
+		return matchProbability(re.Sub[0])
+	case syntax.OpRepeat:
+		p, length := matchProbability(re.Sub[0])
+		return math.Pow(p, float64(re.Min)), length * re.Min
+	case syntax.OpConcat:
+		p, length := 1.0, 0
+		for _, sub := range re.Sub {
+			sp, sl := matchProbability(sub)
+			p, length = p*sp, length+sl
+		}
+		return p, length
+	case syntax.OpAlternate:
+		p, length := 0.0, -1
+		for _, sub := range re.Sub {
+			sp, sl := matchProbability(sub)
+			p += sp
+			if length < 0 || sl < length {
+				length = sl
+			}
+		}
+		return math.Min(1, p), length
+	case syntax.OpNoMatch:
+		return 0, 0
+	default:
+		// Empty matches, anchors, word boundaries and optional repetitions
+		return 1, 0
+	}
+}
+
+// hexFraction is the fraction of the 16 lowercase hex digits within the given rune ranges
+func hexFraction(ranges []rune, foldCase bool) float64 {
+	n := 0
+	for _, digit := range "0123456789abcdef" {
+		for i := 0; i+1 < len(ranges); i += 2 {
+			lo, hi := ranges[i], ranges[i+1]
+			if (digit >= lo && digit <= hi) || (foldCase && digit >= 'a' && digit-'a'+'A' >= lo && digit-'a'+'A' <= hi) {
+				n++
+				break
+			}
+		}
+	}
+	return float64(n) / 16
+}
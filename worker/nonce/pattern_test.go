@@ -0,0 +1,113 @@
+package nonce
+
+import (
+	"encoding/hex"
+	"math"
+	"strings"
+	"testing"
+)
+
+// digestWith returns a 256-bit digest whose hex starts with start and ends with end, with 5s between
+func digestWith(start string, end string) []byte {
+	digest, err := hex.DecodeString(start + strings.Repeat("5", digestHexLength-len(start)-len(end)) + end)
+	if err != nil {
+		panic(err)
+	}
+	return digest
+}
+
+func TestParsePatternInvalid(t *testing.T) {
+	for _, pattern := range []string{
+		"c0ffee",
+		"postfix:c0ffee",
+		"prefix:",
+		"prefix:c0ffeg",
+		"suffix:" + strings.Repeat("0", digestHexLength+1),
+		"mask:ff/f",
+		"mask:ff",
+		"mask:0f/f0",
+		"mask:zz/00",
+		"regex:(",
+		"regex:a{2,1}",
+	} {
+		if p, err := ParsePattern(pattern); err == nil {
+			t.Errorf("ParsePattern(%q) = %s, want an error", pattern, p)
+		}
+	}
+}
+
+func TestPatternMet(t *testing.T) {
+	tests := []struct {
+		pattern string
+		digest  []byte
+		met     bool
+	}{
+		{"prefix:c0ffee", digestWith("c0ffee", ""), true},
+		{"prefix:C0FFEE", digestWith("c0ffee", ""), true},
+		{"prefix:c0ffee", digestWith("c0ffef", ""), false},
+		{"prefix:c0ffee", digestWith("", "c0ffee"), false},
+		{"prefix:abc", digestWith("abc0", ""), true},
+		{"prefix:abc", digestWith("abcf", ""), true},
+		{"prefix:abc", digestWith("abd0", ""), false},
+		{"prefix:" + strings.Repeat("5", digestHexLength), digestWith("", ""), true},
+		{"suffix:beef", digestWith("", "beef"), true},
+		{"suffix:beef", digestWith("beef", ""), false},
+		{"suffix:eef", digestWith("", "beef"), true},
+		{"suffix:eef", digestWith("", "eeff"), false},
+		{"mask:f0/a0", digestWith("af", ""), true},
+		{"mask:f0/a0", digestWith("ba", ""), false},
+		{"mask:ff00ff/120034", digestWith("12ab34", ""), true},
+		{"mask:ff00ff/120034", digestWith("12ab35", ""), false},
+		{"mask:8/8", digestWith("9", ""), true},
+		{"mask:8/8", digestWith("7", ""), false},
+		{"regex:^0{4}", digestWith("0000", ""), true},
+		{"regex:^0{4}", digestWith("000a", ""), false},
+		{"regex:dead", digestWith("", "dead"), true},
+		{"regex:dead", digestWith("", "deaf"), false},
+		{"regex:^[0-7]+5+f$", digestWith("0123", "f"), true},
+		{"regex:^[0-7]+5+f$", digestWith("8123", "f"), false},
+	}
+	for _, test := range tests {
+		p, err := ParsePattern(test.pattern)
+		if err != nil {
+			t.Fatalf("ParsePattern(%q): %v", test.pattern, err)
+		}
+		if got := p.Met(test.digest); got != test.met {
+			t.Errorf("%s.Met(%x) = %t, want %t", test.pattern, test.digest, got, test.met)
+		}
+	}
+}
+
+func TestPatternProbability(t *testing.T) {
+	tests := []struct {
+		pattern     string
+		probability float64
+	}{
+		{"prefix:c0ffee", math.Pow(16, -6)},
+		{"prefix:a", 1.0 / 16},
+		{"suffix:abc", math.Pow(16, -3)},
+		{"mask:ff00ff/120034", math.Pow(2, -16)},
+		{"mask:8/8", 0.5},
+		{"mask:f0f0/1020", math.Pow(2, -8)},
+		{"regex:^c0ffee", math.Pow(16, -6)},
+		{"regex:c0ffee$", math.Pow(16, -6)},
+		{"regex:^[0-7]", 0.5},
+		{"regex:^(a|b)", 2.0 / 16},
+		{"regex:^[A-F]", 0},
+		{"regex:(?i)^[A-F]", 6.0 / 16},
+		{"regex:^0{8}", math.Pow(16, -8)},
+		// An unanchored match could start at any of the 61 places a 4 digit match fits
+		{"regex:dead", 61 * math.Pow(16, -4)},
+		{"regex:^.*", 1},
+		{"regex:^g", 0},
+	}
+	for _, test := range tests {
+		p, err := ParsePattern(test.pattern)
+		if err != nil {
+			t.Fatalf("ParsePattern(%q): %v", test.pattern, err)
+		}
+		if got := p.Probability(); math.Abs(got-test.probability) > 1e-9*test.probability {
+			t.Errorf("%s.Probability() = %g, want %g", test.pattern, got, test.probability)
+		}
+	}
+}
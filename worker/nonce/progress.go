@@ -0,0 +1,255 @@
+package nonce
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultProgressInterval is how many hashes are computed between progress reports when no interval is configured
+const defaultProgressInterval = 1 << 20
+
+// Range is a half-open interval of positions [Start, End), which are the nonces themselves in Sequential order.
+// End is at most NonceSpace, which includes the last nonce.
+type Range struct {
+	Start uint32 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// Progress is reported to WorkerConfig.Progress periodically while a search is running
+type Progress struct {
+	Nonce     uint32
+	Hashes    uint64
+	BestZeros int
+	Cursor    *Cursor
+}
+
+// Cursor is a serialisable checkpoint of a search, which can be set as WorkerConfig.Cursor to resume it
+type Cursor struct {
+	Remaining []Range      `json:"remaining"`
+	Hashes    uint64       `json:"hashes"`
+	BestZeros int          `json:"bestZeros"`
+	Best      *GoldenNonce `json:"best,omitempty"`
+	// Order is the search's order with its defaults filled in, so the resumed search visits the same nonces
+	Order *Order `json:"order,omitempty"`
+}
+
+// PartialResult describes how close a search came when it ended without finding a golden nonce
+type PartialResult struct {
+	// Best has the lowest hash found, and is nil if nothing was hashed
+	Best         *GoldenNonce
+	LeadingZeros int
+	Hashes       uint64
+}
+
+// found is a nonce along with its digest, which the holder owns
+type found struct {
+	nonce  uint32
+	digest []byte
+}
+
+// lower reports whether hash is lower than the digest found so far, or if nothing has been found yet
+func (f *found) lower(hash []byte) bool {
+	return len(f.digest) == 0 || bytes.Compare(hash, f.digest) < 0
+}
+
+// set copies nonce and its hash into f, reusing f's buffer
+func (f *found) set(nonce uint32, hash []byte) {
+	f.nonce = nonce
+	f.digest = append(f.digest[:0], hash...)
+}
+
+// searchState is shared between all goroutines of a single search
+type searchState struct {
+	config   *WorkerConfig
+	ranges   []Range
+	next     []uint64
+	hashes   uint64
+	interval uint64
+	// checkInterval is how many hashes each goroutine computes between recording them and checking the context
+	checkInterval uint64
+	// lastReport is when Progress was last called, in Unix nanoseconds, if reporting every ProgressPeriod
+	lastReport int64
+	reportMu   sync.Mutex
+	// best is the lowest hash found by any goroutine
+	bestMu sync.Mutex
+	best   found
+	// target is the header's target in header mode, or the configured pattern or target otherwise
+	target Predicate
+	// header has the extra nonce rolled into it in header mode
+	header *BlockHeader
+	hasher Hasher
+	// encoding writes the nonce between prefix and suffix
+	encoding Encoding
+	prefix   []byte
+	suffix   []byte
+	// midstate has absorbed the prefix, if the hasher supports it
+	midstate Midstate
+	// order has its defaults filled in, and ordering maps the positions in ranges to the nonces hashed there
+	order    Order
+	ordering ordering
+}
+
+// newSearchState prepares the search of ranges, failing if config's encoding is invalid or the extra nonce can't be
+// rolled into its header
+func newSearchState(config *WorkerConfig, ranges []Range) (*searchState, error) {
+	state := &searchState{
+		config:     config,
+		ranges:     ranges,
+		next:       make([]uint64, len(ranges)),
+		interval:   config.ProgressInterval,
+		lastReport: time.Now().UnixNano(),
+		best:       found{digest: make([]byte, 0, 64)},
+	}
+	if state.interval == 0 {
+		state.interval = defaultProgressInterval
+	}
+	for i, r := range ranges {
+		state.next[i] = uint64(r.Start)
+	}
+	state.target = config.Target
+	if config.Pattern != nil {
+		state.target = config.Pattern
+	}
+	if config.Header != nil {
+		state.target = config.Header.Target()
+		header, err := config.Header.Rolled(config.ExtraNonce)
+		if err != nil {
+			return nil, err
+		}
+		state.header = header
+	}
+	state.hasher = config.Hasher
+	if state.hasher == nil {
+		state.hasher = sha256dHasher{}
+	}
+	state.checkInterval = cancelCheckInterval
+	switch state.hasher.(type) {
+	case *ScryptHasher, *Argon2Hasher:
+		state.checkInterval = memoryHardCheckInterval
+	}
+	state.encoding = config.Encoding.withDefaults()
+	if state.header != nil {
+		state.encoding = headerEncoding
+	} else if err := state.encoding.validate(); err != nil {
+		return nil, err
+	}
+	state.prefix, state.suffix = searchPayload(config, state.header, state.encoding)
+	if mh, ok := state.hasher.(MidstateHasher); ok {
+		state.midstate = mh.Midstate(state.prefix)
+	}
+	state.order = resolveOrder(config)
+	state.ordering = newOrdering(state.order, config.LowerBound, config.UpperBound)
+	if config.Cursor != nil {
+		state.hashes = config.Cursor.Hashes
+		if best := config.Cursor.Best; best != nil {
+			if digest, err := hex.DecodeString(best.Hash); err == nil {
+				state.best.set(best.Nonce, digest)
+			}
+		}
+	}
+	return state, nil
+}
+
+// goal describes what the search is looking for, for error messages
+func (s *searchState) goal() string {
+	if p, ok := s.target.(*Pattern); ok {
+		return fmt.Sprintf("matching pattern %s", p)
+	}
+	return fmt.Sprintf("below target %s", s.target)
+}
+
+// record notes that the goroutine searching ranges[idx] has hashed count more nonces, finishing at position,
+// with best the lowest hash it has found. Metrics are updated here in batches rather than for every hash.
+func (s *searchState) record(idx int, position uint32, count uint64, best *found) {
+	atomic.StoreUint64(&s.next[idx], uint64(position)+1)
+
+	s.bestMu.Lock()
+	if len(best.digest) > 0 && s.best.lower(best.digest) {
+		s.best.set(best.nonce, best.digest)
+	}
+	s.bestMu.Unlock()
+
+	if s.config.HashCounter != nil {
+		s.config.HashCounter.Add(float64(count))
+	}
+	total := atomic.AddUint64(&s.hashes, count)
+	if !s.due(total, count) {
+		return
+	}
+
+	s.reportMu.Lock()
+	defer s.reportMu.Unlock()
+	cursor := s.cursor()
+	s.config.Progress(Progress{
+		Nonce:     s.ordering.nonce(position),
+		Hashes:    total,
+		BestZeros: cursor.BestZeros,
+		Cursor:    cursor,
+	})
+}
+
+// due reports whether Progress should be called after recording count more hashes, making total. With a
+// ProgressPeriod only the first goroutine to record after each period reports.
+func (s *searchState) due(total uint64, count uint64) bool {
+	if s.config.Progress == nil {
+		return false
+	}
+	if s.config.ProgressPeriod <= 0 {
+		return (total-count)/s.interval != total/s.interval
+	}
+
+	last := atomic.LoadInt64(&s.lastReport)
+	now := time.Now().UnixNano()
+	return now-last >= int64(s.config.ProgressPeriod) && atomic.CompareAndSwapInt64(&s.lastReport, last, now)
+}
+
+// partial snapshots the lowest hash found so far, along with how many hashes were computed
+func (s *searchState) partial() *PartialResult {
+	s.bestMu.Lock()
+	defer s.bestMu.Unlock()
+
+	p := &PartialResult{Hashes: atomic.LoadUint64(&s.hashes)}
+	if len(s.best.digest) > 0 {
+		p.Best = &GoldenNonce{s.best.nonce, s.config.ExtraNonce, hex.EncodeToString(s.best.digest)}
+		p.LeadingZeros = leadingZeros(s.best.digest)
+	}
+	return p
+}
+
+// cursor snapshots the ranges which are yet to be searched
+func (s *searchState) cursor() *Cursor {
+	remaining := make([]Range, 0, len(s.ranges))
+	for i, r := range s.ranges {
+		next := atomic.LoadUint64(&s.next[i])
+		if next < r.End {
+			remaining = append(remaining, Range{uint32(next), r.End})
+		}
+	}
+	partial := s.partial()
+	cursor := &Cursor{
+		Remaining: remaining,
+		Hashes:    partial.Hashes,
+		BestZeros: partial.LeadingZeros,
+		Best:      partial.Best,
+	}
+	if s.order.Kind != Sequential {
+		order := s.order
+		cursor.Order = &order
+	}
+	return cursor
+}
+
+// remaining returns the non-empty ranges left to search
+func (c *Cursor) remaining() []Range {
+	ranges := make([]Range, 0, len(c.Remaining))
+	for _, r := range c.Remaining {
+		if uint64(r.Start) < r.End {
+			ranges = append(ranges, r)
+		}
+	}
+	return ranges
+}
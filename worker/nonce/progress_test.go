@@ -0,0 +1,162 @@
+package nonce
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+// resumeOrders are the orders a checkpoint is resumed in, seeded so that a search is repeatable
+var resumeOrders = []Order{{Kind: Sequential}, {Kind: Shuffled, Seed: 42}}
+
+// stopAtCheckpoint runs search with config until its first progress report, returning the cursor reported there
+// after a round trip through JSON, as a worker's checkpoint makes
+func stopAtCheckpoint(t *testing.T, config *WorkerConfig, search func(context.Context, *WorkerConfig) error) *Cursor {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var saved []byte
+	config.ProgressInterval = cancelCheckInterval
+	config.Progress = func(p Progress) {
+		if saved == nil {
+			saved, _ = json.Marshal(p.Cursor)
+			cancel()
+		}
+	}
+	if err := search(ctx, config); err == nil {
+		t.Fatal("Search finished before its first checkpoint")
+	} else if _, ok := err.(*SearchCancelledError); !ok {
+		t.Fatalf("Search stopped at its first checkpoint = %v, want a *SearchCancelledError", err)
+	}
+
+	cursor := &Cursor{}
+	if err := json.Unmarshal(saved, cursor); err != nil {
+		t.Fatalf("Unmarshal(%s): %v", saved, err)
+	}
+	return cursor
+}
+
+func TestResumeFindsSameNonce(t *testing.T) {
+	for _, order := range resumeOrders {
+		config := func() *WorkerConfig {
+			return &WorkerConfig{
+				Contents:   "COMSM0010cloud",
+				UpperBound: 1 << 20,
+				Target:     TargetFromLeadingZeros(16),
+				Threads:    1,
+				Order:      order,
+			}
+		}
+		want, err := CalculateGoldenNonce(config())
+		if err != nil {
+			t.Fatalf("%s: %v", order, err)
+		}
+
+		cursor := stopAtCheckpoint(t, config(), func(ctx context.Context, config *WorkerConfig) error {
+			_, err := CalculateGoldenNonceContext(ctx, config)
+			return err
+		})
+		resumed := config()
+		resumed.Cursor = cursor
+		got, err := CalculateGoldenNonce(resumed)
+		if err != nil || *got != *want {
+			t.Errorf("%s: resumed search found %+v, %v, want %+v", order, got, err, want)
+		}
+	}
+}
+
+func TestResumeSkipsSearched(t *testing.T) {
+	const upper = 20000
+	for _, order := range resumeOrders {
+		config := func() *WorkerConfig {
+			return &WorkerConfig{
+				Contents:   "COMSM0010cloud",
+				UpperBound: upper,
+				// Every nonce is golden, so enumerating them lists every nonce hashed
+				Target:  TargetFromLeadingZeros(0),
+				Threads: 3,
+				Order:   order,
+			}
+		}
+		cursor := stopAtCheckpoint(t, config(), func(ctx context.Context, config *WorkerConfig) error {
+			_, err := EnumerateGoldenNonces(ctx, config, 0)
+			return err
+		})
+
+		resumed := config()
+		resumed.Cursor = cursor
+		e, err := EnumerateGoldenNonces(context.Background(), resumed, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", order, err)
+		}
+
+		// The resumed search hashes exactly the nonces at the positions the cursor has left
+		ordering := newOrdering(resolveOrder(resumed), 0, upper)
+		want := make(map[uint32]bool)
+		for _, r := range cursor.Remaining {
+			for p := uint64(r.Start); p < r.End; p++ {
+				want[ordering.nonce(uint32(p))] = true
+			}
+		}
+		if len(want) == 0 || len(want) == upper {
+			t.Fatalf("%s: cursor leaves %d of %d nonces, want some searched and some left", order, len(want), upper)
+		}
+		seen := make(map[uint32]bool)
+		for _, n := range e.Nonces {
+			if !want[n.Nonce] || seen[n.Nonce] {
+				t.Errorf("%s: resumed search hashed nonce %d again", order, n.Nonce)
+			}
+			seen[n.Nonce] = true
+		}
+		if len(seen) != len(want) {
+			t.Errorf("%s: resumed search hashed %d nonces, want the %d left", order, len(seen), len(want))
+		}
+		if e.Hashes != cursor.Hashes+uint64(len(want)) {
+			t.Errorf("%s: resumed search counted %d hashes, want %d carried on from the cursor's %d", order, e.Hashes, cursor.Hashes+uint64(len(want)), cursor.Hashes)
+		}
+	}
+}
+
+func TestNoNonceFoundPartial(t *testing.T) {
+	config := &WorkerConfig{
+		Contents:   "COMSM0010cloud",
+		LowerBound: 100,
+		UpperBound: 5100,
+		Target:     unreachable,
+		Threads:    3,
+	}
+	_, err := CalculateGoldenNonce(config)
+	notFound, ok := err.(*NoNonceFoundError)
+	if !ok {
+		t.Fatalf("Search for an unreachable target = %v, want a *NoNonceFoundError", err)
+	}
+
+	// Find the lowest double SHA-256 digest directly
+	var best []byte
+	var bestNonce uint32
+	for n := uint32(100); n < 5100; n++ {
+		first := sha256.Sum256(Payload(config, n))
+		digest := sha256.Sum256(first[:])
+		if best == nil || bytes.Compare(digest[:], best) < 0 {
+			best, bestNonce = digest[:], n
+		}
+	}
+
+	p := notFound.Partial
+	if p == nil || p.Best == nil {
+		t.Fatalf("Partial result = %+v, want the best hash", p)
+	}
+	if p.Best.Nonce != bestNonce || p.Best.Hash != hex.EncodeToString(best) {
+		t.Errorf("Best = nonce %d hash %s, want nonce %d hash %x", p.Best.Nonce, p.Best.Hash, bestNonce, best)
+	}
+	if p.LeadingZeros != leadingZeros(best) {
+		t.Errorf("LeadingZeros = %d, want %d", p.LeadingZeros, leadingZeros(best))
+	}
+	if p.Hashes != 5000 {
+		t.Errorf("Hashes = %d, want the range's 5000", p.Hashes)
+	}
+}
@@ -0,0 +1,268 @@
+package nonce
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// Names of the SHA-256 backends, as reported by SHA256Backend
+const (
+	StdlibBackend string = "crypto/sha256"
+	SHANIBackend  string = "sha-ni"
+	AVX2Backend   string = "avx2"
+)
+
+// maxLanes is the most nonces any backend hashes at once
+const maxLanes = 8
+
+// Set at startup from the CPU's features, and only changed by tests
+var (
+	useSHANI bool
+	useAVX2  bool
+)
+
+var sha256K = [64]uint32{
+	0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+	0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+	0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+	0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+	0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+	0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+	0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+	0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2,
+}
+
+var sha256IV = [8]uint32{
+	0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19,
+}
+
+// SHA256Backend names the fastest SHA-256 implementation this CPU supports, which the SHA-256 hashers use to
+// finish each nonce from their midstate
+func SHA256Backend() string {
+	if useSHANI {
+		return SHANIBackend
+	} else if useAVX2 {
+		return AVX2Backend
+	}
+	return StdlibBackend
+}
+
+// blockGeneric compresses each 64 byte block of p into h. It only finishes single nonces when AVX2 is the fastest
+// backend, as batches go through block8AVX2.
+func blockGeneric(h *[8]uint32, p []byte) {
+	var w [64]uint32
+	for ; len(p) >= 64; p = p[64:] {
+		for i := 0; i < 16; i++ {
+			w[i] = binary.BigEndian.Uint32(p[4*i:])
+		}
+		for i := 16; i < 64; i++ {
+			s0 := bits.RotateLeft32(w[i-15], -7) ^ bits.RotateLeft32(w[i-15], -18) ^ (w[i-15] >> 3)
+			s1 := bits.RotateLeft32(w[i-2], -17) ^ bits.RotateLeft32(w[i-2], -19) ^ (w[i-2] >> 10)
+			w[i] = w[i-16] + s0 + w[i-7] + s1
+		}
+
+		a, b, c, d, e, f, g, hh := h[0], h[1], h[2], h[3], h[4], h[5], h[6], h[7]
+		for i := 0; i < 64; i++ {
+			t1 := hh + (bits.RotateLeft32(e, -6) ^ bits.RotateLeft32(e, -11) ^ bits.RotateLeft32(e, -25)) +
+				((e & f) ^ (^e & g)) + sha256K[i] + w[i]
+			t2 := (bits.RotateLeft32(a, -2) ^ bits.RotateLeft32(a, -13) ^ bits.RotateLeft32(a, -22)) +
+				((a & b) ^ (a & c) ^ (b & c))
+			hh, g, f, e, d, c, b, a = g, f, e, d+t1, c, b, a, t1+t2
+		}
+		h[0] += a
+		h[1] += b
+		h[2] += c
+		h[3] += d
+		h[4] += e
+		h[5] += f
+		h[6] += g
+		h[7] += hh
+	}
+}
+
+// laneBlock is one 64 byte block for each of maxLanes hashes, transposed so that each word holds every lane
+type laneBlock struct {
+	h [8][maxLanes]uint32
+	w [16][maxLanes]uint32
+}
+
+// fastSHA256Midstate finishes SHA-256 from the state after the prefix's full blocks, without going through
+// crypto/sha256, using SHA-NI or AVX2 where the CPU has them
+type fastSHA256Midstate struct {
+	h [8]uint32
+	// tail is the part of the prefix after its last full block
+	tail   []byte
+	length uint64
+	double bool
+	// shani and avx2 pick the backend, calling the assembly directly so that nothing escapes to the heap
+	shani bool
+	avx2  bool
+	// buf holds the padded final blocks, and lanes those of every lane
+	buf   []byte
+	lanes laneBlock
+}
+
+// newSHA256Midstate absorbs the prefix for reuse across nonces, using the fastest backend the CPU supports
+func newSHA256Midstate(prefix []byte, double bool) Midstate {
+	if !useSHANI && !useAVX2 {
+		return newStdlibSHA256Midstate(prefix, double)
+	}
+
+	m := &fastSHA256Midstate{h: sha256IV, length: uint64(len(prefix)), double: double, shani: useSHANI, avx2: !useSHANI}
+	full := len(prefix) &^ 63
+	m.block(&m.h, prefix[:full])
+	m.tail = append([]byte(nil), prefix[full:]...)
+	return m
+}
+
+// block compresses each 64 byte block of p into h, with SHA-NI if the midstate uses it
+func (m *fastSHA256Midstate) block(h *[8]uint32, p []byte) {
+	if m.shani {
+		blockSHANI(h, p)
+	} else {
+		blockGeneric(h, p)
+	}
+}
+
+func (m *fastSHA256Midstate) Hash(dst []byte, suffix []byte) []byte {
+	h := m.h
+	m.buf = pad(append(append(m.buf[:0], m.tail...), suffix...), m.length+uint64(len(suffix)))
+	m.block(&h, m.buf)
+
+	if m.double {
+		var second [64]byte
+		for i, v := range h {
+			binary.BigEndian.PutUint32(second[4*i:], v)
+		}
+		second[32] = 0x80
+		binary.BigEndian.PutUint64(second[56:], 256)
+		h = sha256IV
+		m.block(&h, second[:])
+	}
+
+	for _, v := range h {
+		dst = append(dst, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	return dst
+}
+
+func (m *fastSHA256Midstate) Clone() Midstate {
+	return &fastSHA256Midstate{
+		h:      m.h,
+		tail:   m.tail,
+		length: m.length,
+		double: m.double,
+		shani:  m.shani,
+		avx2:   m.avx2,
+	}
+}
+
+// batchSize is how many suffixes hashBatch hashes at once, or 1 when the backend hashes one at a time
+func (m *fastSHA256Midstate) batchSize() int {
+	if !m.avx2 {
+		return 1
+	}
+	return maxLanes
+}
+
+// hashBatch writes the digest of the prefix followed by each suffix into digests, all at once across the lanes.
+// Each suffix and its padding may take a different number of blocks.
+func (m *fastSHA256Midstate) hashBatch(digests [][]byte, suffixes [][]byte) {
+	if !m.avx2 {
+		for lane, suffix := range suffixes {
+			digests[lane] = m.Hash(digests[lane][:0], suffix)
+		}
+		return
+	}
+
+	var final [8][maxLanes]uint32
+	b := &m.lanes
+	for i := range b.h {
+		for lane := range b.h[i] {
+			b.h[i][lane] = m.h[i]
+		}
+	}
+
+	// Pad every lane into one buffer, each taking a whole number of blocks
+	m.buf = m.buf[:0]
+	var starts, blocks [maxLanes]int
+	most := 0
+	for lane, suffix := range suffixes {
+		starts[lane] = len(m.buf)
+		m.buf = pad(append(append(m.buf, m.tail...), suffix...), m.length+uint64(len(suffix)))
+		blocks[lane] = (len(m.buf) - starts[lane]) / 64
+		if blocks[lane] > most {
+			most = blocks[lane]
+		}
+	}
+
+	for j := 0; j < most; j++ {
+		for lane := range suffixes {
+			if j < blocks[lane] {
+				block := m.buf[starts[lane]+64*j:]
+				for i := range b.w {
+					b.w[i][lane] = binary.BigEndian.Uint32(block[4*i:])
+				}
+			}
+		}
+		block8AVX2(b)
+		for lane := range suffixes {
+			if j == blocks[lane]-1 {
+				for i := range final {
+					final[i][lane] = b.h[i][lane]
+				}
+			} else if j >= blocks[lane] {
+				// Lanes which have finished were compressed with a stale block, so restore their state
+				for i := range b.h {
+					b.h[i][lane] = final[i][lane]
+				}
+			}
+		}
+	}
+
+	if m.double {
+		// The first digest fits in a single block, whose padding is the same for every lane
+		for i := range b.w {
+			for lane := range b.w[i] {
+				switch {
+				case i < 8:
+					b.w[i][lane] = final[i][lane]
+				case i == 8:
+					b.w[i][lane] = 0x80000000
+				case i == 15:
+					b.w[i][lane] = 256
+				default:
+					b.w[i][lane] = 0
+				}
+			}
+		}
+		for i := range b.h {
+			for lane := range b.h[i] {
+				b.h[i][lane] = sha256IV[i]
+			}
+		}
+		block8AVX2(b)
+		final = b.h
+	}
+
+	for lane := range suffixes {
+		d := digests[lane][:0]
+		for i := range final {
+			v := final[i][lane]
+			d = append(d, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+		}
+		digests[lane] = d
+	}
+}
+
+// pad appends SHA-256's padding for a message of length bytes to buf, which ends with the message's last partial
+// block
+func pad(buf []byte, length uint64) []byte {
+	buf = append(buf, 0x80)
+	for len(buf)%64 != 56 {
+		buf = append(buf, 0)
+	}
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], length*8)
+	return append(buf, size[:]...)
+}
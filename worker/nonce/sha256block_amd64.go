@@ -0,0 +1,49 @@
+//go:build amd64 && !purego
+// +build amd64,!purego
+
+package nonce
+
+// Feature bits reported by CPUID
+const (
+	cpuidSSSE3   = 1 << 9  // leaf 1, ECX
+	cpuidSSE41   = 1 << 19 // leaf 1, ECX
+	cpuidOSXSAVE = 1 << 27 // leaf 1, ECX
+	cpuidAVX     = 1 << 28 // leaf 1, ECX
+	cpuidAVX2    = 1 << 5  // leaf 7, EBX
+	cpuidSHA     = 1 << 29 // leaf 7, EBX
+)
+
+func init() {
+	maxLeaf, _, _, _ := cpuid(0, 0)
+	if maxLeaf < 7 {
+		return
+	}
+	_, _, ecx1, _ := cpuid(1, 0)
+	_, ebx7, _, _ := cpuid(7, 0)
+
+	// The OS has to save the YMM registers as well as the CPU having them
+	osAVX := false
+	if ecx1&cpuidOSXSAVE != 0 {
+		xcr0, _ := xgetbv()
+		osAVX = xcr0&6 == 6
+	}
+
+	useSHANI = ebx7&cpuidSHA != 0 && ecx1&cpuidSSSE3 != 0 && ecx1&cpuidSSE41 != 0
+	useAVX2 = osAVX && ecx1&cpuidAVX != 0 && ebx7&cpuidAVX2 != 0
+}
+
+// cpuid executes the CPUID instruction for the given leaf and subleaf
+func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+
+// xgetbv reads extended control register 0, which says which register sets the OS saves
+func xgetbv() (eax, edx uint32)
+
+// blockSHANI compresses each 64 byte block of p into h using the SHA extensions
+//
+//go:noescape
+func blockSHANI(h *[8]uint32, p []byte)
+
+// block8AVX2 compresses the block of every lane into its state, eight lanes at a time in the YMM registers
+//
+//go:noescape
+func block8AVX2(b *laneBlock)
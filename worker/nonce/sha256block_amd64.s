@@ -0,0 +1,358 @@
+//go:build amd64 && !purego
+// +build amd64,!purego
+
+#include "textflag.h"
+
+// func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+TEXT ·cpuid(SB), NOSPLIT, $0-24
+	MOVL eaxArg+0(FP), AX
+	MOVL ecxArg+4(FP), CX
+	CPUID
+	MOVL AX, eax+8(FP)
+	MOVL BX, ebx+12(FP)
+	MOVL CX, ecx+16(FP)
+	MOVL DX, edx+20(FP)
+	RET
+
+// func xgetbv() (eax, edx uint32)
+TEXT ·xgetbv(SB), NOSPLIT, $0-8
+	MOVL $0, CX
+	XGETBV
+	MOVL AX, eax+0(FP)
+	MOVL DX, edx+4(FP)
+	RET
+
+// Reverses the bytes of each 32-bit word, as SHA-256 reads the message big-endian
+DATA flipMask<>+0(SB)/8, $0x0405060700010203
+DATA flipMask<>+8(SB)/8, $0x0c0d0e0f08090a0b
+GLOBL flipMask<>(SB), RODATA|NOPTR, $16
+
+// SHA-NI keeps the state as ABEF in X1 and CDGH in X2, and each group of four message words in X3 to X6.
+// Four rounds add the round constants at offset k to the message words m.
+#define SHANI_ROUNDS(m, k) \
+	MOVOU k(AX), X0; \
+	PADDD m, X0; \
+	SHA256RNDS2 X0, X1, X2; \
+	PSHUFD $0x0e, X0, X0; \
+	SHA256RNDS2 X0, X2, X1
+
+#define SHANI_LOAD(off, m) \
+	MOVOU off(SI), m; \
+	PSHUFB X8, m
+
+// Extends the schedule by four words, w0 to w3 holding the previous sixteen, writing them over w0
+#define SHANI_SCHEDULE(w0, w1, w2, w3) \
+	SHA256MSG1 w1, w0; \
+	MOVO w3, X7; \
+	PALIGNR $4, w2, X7; \
+	PADDD X7, w0; \
+	SHA256MSG2 w3, w0
+
+// func blockSHANI(h *[8]uint32, p []byte)
+TEXT ·blockSHANI(SB), NOSPLIT, $0-32
+	MOVQ h+0(FP), DI
+	MOVQ p_base+8(FP), SI
+	MOVQ p_len+16(FP), DX
+	ANDQ $~63, DX
+	TESTQ DX, DX
+	JZ shaniDone
+	ADDQ SI, DX
+
+	// Rearrange a b c d, e f g h into ABEF and CDGH
+	MOVOU (DI), X1
+	MOVOU 16(DI), X2
+	PSHUFD $0xb1, X1, X1
+	PSHUFD $0x1b, X2, X2
+	MOVO X1, X7
+	PALIGNR $8, X2, X1
+	PBLENDW $0xf0, X7, X2
+	MOVOU flipMask<>(SB), X8
+	LEAQ ·sha256K(SB), AX
+
+shaniLoop:
+	MOVO X1, X9
+	MOVO X2, X10
+	SHANI_LOAD(0, X3)
+	SHANI_ROUNDS(X3, 0)
+	SHANI_LOAD(16, X4)
+	SHANI_ROUNDS(X4, 16)
+	SHANI_LOAD(32, X5)
+	SHANI_ROUNDS(X5, 32)
+	SHANI_LOAD(48, X6)
+	SHANI_ROUNDS(X6, 48)
+	SHANI_SCHEDULE(X3, X4, X5, X6)
+	SHANI_ROUNDS(X3, 64)
+	SHANI_SCHEDULE(X4, X5, X6, X3)
+	SHANI_ROUNDS(X4, 80)
+	SHANI_SCHEDULE(X5, X6, X3, X4)
+	SHANI_ROUNDS(X5, 96)
+	SHANI_SCHEDULE(X6, X3, X4, X5)
+	SHANI_ROUNDS(X6, 112)
+	SHANI_SCHEDULE(X3, X4, X5, X6)
+	SHANI_ROUNDS(X3, 128)
+	SHANI_SCHEDULE(X4, X5, X6, X3)
+	SHANI_ROUNDS(X4, 144)
+	SHANI_SCHEDULE(X5, X6, X3, X4)
+	SHANI_ROUNDS(X5, 160)
+	SHANI_SCHEDULE(X6, X3, X4, X5)
+	SHANI_ROUNDS(X6, 176)
+	SHANI_SCHEDULE(X3, X4, X5, X6)
+	SHANI_ROUNDS(X3, 192)
+	SHANI_SCHEDULE(X4, X5, X6, X3)
+	SHANI_ROUNDS(X4, 208)
+	SHANI_SCHEDULE(X5, X6, X3, X4)
+	SHANI_ROUNDS(X5, 224)
+	SHANI_SCHEDULE(X6, X3, X4, X5)
+	SHANI_ROUNDS(X6, 240)
+	PADDD X9, X1
+	PADDD X10, X2
+	ADDQ $64, SI
+	CMPQ SI, DX
+	JNE shaniLoop
+
+	// Rearrange ABEF and CDGH back into a b c d, e f g h
+	PSHUFD $0x1b, X1, X1
+	PSHUFD $0xb1, X2, X2
+	MOVO X1, X7
+	PBLENDW $0xf0, X2, X1
+	PALIGNR $8, X7, X2
+	MOVOU X1, (DI)
+	MOVOU X2, 16(DI)
+
+shaniDone:
+	RET
+
+// The AVX2 backend holds word i of all eight lanes' states in Yi, and keeps the 64 word message schedule of
+// every lane on the stack. ROTR computes the 32-bit right rotation of x by n into dst, using Y9 and Y10.
+#define ROTR(x, n, m, dst) \
+	VPSRLD $n, x, Y9; \
+	VPSLLD $m, x, Y10; \
+	VPOR Y9, Y10, dst
+
+#define ROTR_XOR(x, n, m, dst) \
+	VPSRLD $n, x, Y9; \
+	VPSLLD $m, x, Y10; \
+	VPXOR Y9, dst, dst; \
+	VPXOR Y10, dst, dst
+
+// Message word t = sigma1(w[t-2]) + w[t-7] + sigma0(w[t-15]) + w[t-16]
+#define EXTEND(t) \
+	VMOVDQU ((t-15)*32)(SP), Y8; \
+	ROTR(Y8, 7, 25, Y11); \
+	ROTR_XOR(Y8, 18, 14, Y11); \
+	VPSRLD $3, Y8, Y9; \
+	VPXOR Y9, Y11, Y11; \
+	VMOVDQU ((t-2)*32)(SP), Y8; \
+	ROTR(Y8, 17, 15, Y12); \
+	ROTR_XOR(Y8, 19, 13, Y12); \
+	VPSRLD $10, Y8, Y9; \
+	VPXOR Y9, Y12, Y12; \
+	VPADDD Y11, Y12, Y12; \
+	VPADDD ((t-16)*32)(SP), Y12, Y12; \
+	VPADDD ((t-7)*32)(SP), Y12, Y12; \
+	VMOVDQU Y12, (t*32)(SP)
+
+// One round, adding T1 to d and writing T1 + T2 over h, so that the caller rotates the names of the state
+#define ROUND(a, b, c, d, e, f, g, h, t) \
+	VPBROADCASTD (t*4)(AX), Y8; \
+	VPADDD (t*32)(SP), Y8, Y8; \
+	VPADDD h, Y8, Y8; \
+	ROTR(e, 6, 26, Y11); \
+	ROTR_XOR(e, 11, 21, Y11); \
+	ROTR_XOR(e, 25, 7, Y11); \
+	VPADDD Y11, Y8, Y8; \
+	VPAND f, e, Y9; \
+	VPANDN g, e, Y10; \
+	VPXOR Y9, Y10, Y9; \
+	VPADDD Y9, Y8, Y8; \
+	VPADDD Y8, d, d; \
+	ROTR(a, 2, 30, Y11); \
+	ROTR_XOR(a, 13, 19, Y11); \
+	ROTR_XOR(a, 22, 10, Y11); \
+	VPADDD Y11, Y8, Y8; \
+	VPXOR a, b, Y9; \
+	VPAND c, Y9, Y9; \
+	VPAND a, b, Y10; \
+	VPXOR Y10, Y9, Y9; \
+	VPADDD Y9, Y8, h
+
+// func block8AVX2(b *laneBlock)
+TEXT ·block8AVX2(SB), 0, $2048-8
+	MOVQ b+0(FP), DI
+	LEAQ ·sha256K(SB), AX
+
+	VMOVDQU (256+0*32)(DI), Y8
+	VMOVDQU Y8, (0*32)(SP)
+	VMOVDQU (256+1*32)(DI), Y8
+	VMOVDQU Y8, (1*32)(SP)
+	VMOVDQU (256+2*32)(DI), Y8
+	VMOVDQU Y8, (2*32)(SP)
+	VMOVDQU (256+3*32)(DI), Y8
+	VMOVDQU Y8, (3*32)(SP)
+	VMOVDQU (256+4*32)(DI), Y8
+	VMOVDQU Y8, (4*32)(SP)
+	VMOVDQU (256+5*32)(DI), Y8
+	VMOVDQU Y8, (5*32)(SP)
+	VMOVDQU (256+6*32)(DI), Y8
+	VMOVDQU Y8, (6*32)(SP)
+	VMOVDQU (256+7*32)(DI), Y8
+	VMOVDQU Y8, (7*32)(SP)
+	VMOVDQU (256+8*32)(DI), Y8
+	VMOVDQU Y8, (8*32)(SP)
+	VMOVDQU (256+9*32)(DI), Y8
+	VMOVDQU Y8, (9*32)(SP)
+	VMOVDQU (256+10*32)(DI), Y8
+	VMOVDQU Y8, (10*32)(SP)
+	VMOVDQU (256+11*32)(DI), Y8
+	VMOVDQU Y8, (11*32)(SP)
+	VMOVDQU (256+12*32)(DI), Y8
+	VMOVDQU Y8, (12*32)(SP)
+	VMOVDQU (256+13*32)(DI), Y8
+	VMOVDQU Y8, (13*32)(SP)
+	VMOVDQU (256+14*32)(DI), Y8
+	VMOVDQU Y8, (14*32)(SP)
+	VMOVDQU (256+15*32)(DI), Y8
+	VMOVDQU Y8, (15*32)(SP)
+
+	EXTEND(16)
+	EXTEND(17)
+	EXTEND(18)
+	EXTEND(19)
+	EXTEND(20)
+	EXTEND(21)
+	EXTEND(22)
+	EXTEND(23)
+	EXTEND(24)
+	EXTEND(25)
+	EXTEND(26)
+	EXTEND(27)
+	EXTEND(28)
+	EXTEND(29)
+	EXTEND(30)
+	EXTEND(31)
+	EXTEND(32)
+	EXTEND(33)
+	EXTEND(34)
+	EXTEND(35)
+	EXTEND(36)
+	EXTEND(37)
+	EXTEND(38)
+	EXTEND(39)
+	EXTEND(40)
+	EXTEND(41)
+	EXTEND(42)
+	EXTEND(43)
+	EXTEND(44)
+	EXTEND(45)
+	EXTEND(46)
+	EXTEND(47)
+	EXTEND(48)
+	EXTEND(49)
+	EXTEND(50)
+	EXTEND(51)
+	EXTEND(52)
+	EXTEND(53)
+	EXTEND(54)
+	EXTEND(55)
+	EXTEND(56)
+	EXTEND(57)
+	EXTEND(58)
+	EXTEND(59)
+	EXTEND(60)
+	EXTEND(61)
+	EXTEND(62)
+	EXTEND(63)
+
+	VMOVDQU (0*32)(DI), Y0
+	VMOVDQU (1*32)(DI), Y1
+	VMOVDQU (2*32)(DI), Y2
+	VMOVDQU (3*32)(DI), Y3
+	VMOVDQU (4*32)(DI), Y4
+	VMOVDQU (5*32)(DI), Y5
+	VMOVDQU (6*32)(DI), Y6
+	VMOVDQU (7*32)(DI), Y7
+
+	ROUND(Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7, 0)
+	ROUND(Y7, Y0, Y1, Y2, Y3, Y4, Y5, Y6, 1)
+	ROUND(Y6, Y7, Y0, Y1, Y2, Y3, Y4, Y5, 2)
+	ROUND(Y5, Y6, Y7, Y0, Y1, Y2, Y3, Y4, 3)
+	ROUND(Y4, Y5, Y6, Y7, Y0, Y1, Y2, Y3, 4)
+	ROUND(Y3, Y4, Y5, Y6, Y7, Y0, Y1, Y2, 5)
+	ROUND(Y2, Y3, Y4, Y5, Y6, Y7, Y0, Y1, 6)
+	ROUND(Y1, Y2, Y3, Y4, Y5, Y6, Y7, Y0, 7)
+	ROUND(Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7, 8)
+	ROUND(Y7, Y0, Y1, Y2, Y3, Y4, Y5, Y6, 9)
+	ROUND(Y6, Y7, Y0, Y1, Y2, Y3, Y4, Y5, 10)
+	ROUND(Y5, Y6, Y7, Y0, Y1, Y2, Y3, Y4, 11)
+	ROUND(Y4, Y5, Y6, Y7, Y0, Y1, Y2, Y3, 12)
+	ROUND(Y3, Y4, Y5, Y6, Y7, Y0, Y1, Y2, 13)
+	ROUND(Y2, Y3, Y4, Y5, Y6, Y7, Y0, Y1, 14)
+	ROUND(Y1, Y2, Y3, Y4, Y5, Y6, Y7, Y0, 15)
+	ROUND(Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7, 16)
+	ROUND(Y7, Y0, Y1, Y2, Y3, Y4, Y5, Y6, 17)
+	ROUND(Y6, Y7, Y0, Y1, Y2, Y3, Y4, Y5, 18)
+	ROUND(Y5, Y6, Y7, Y0, Y1, Y2, Y3, Y4, 19)
+	ROUND(Y4, Y5, Y6, Y7, Y0, Y1, Y2, Y3, 20)
+	ROUND(Y3, Y4, Y5, Y6, Y7, Y0, Y1, Y2, 21)
+	ROUND(Y2, Y3, Y4, Y5, Y6, Y7, Y0, Y1, 22)
+	ROUND(Y1, Y2, Y3, Y4, Y5, Y6, Y7, Y0, 23)
+	ROUND(Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7, 24)
+	ROUND(Y7, Y0, Y1, Y2, Y3, Y4, Y5, Y6, 25)
+	ROUND(Y6, Y7, Y0, Y1, Y2, Y3, Y4, Y5, 26)
+	ROUND(Y5, Y6, Y7, Y0, Y1, Y2, Y3, Y4, 27)
+	ROUND(Y4, Y5, Y6, Y7, Y0, Y1, Y2, Y3, 28)
+	ROUND(Y3, Y4, Y5, Y6, Y7, Y0, Y1, Y2, 29)
+	ROUND(Y2, Y3, Y4, Y5, Y6, Y7, Y0, Y1, 30)
+	ROUND(Y1, Y2, Y3, Y4, Y5, Y6, Y7, Y0, 31)
+	ROUND(Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7, 32)
+	ROUND(Y7, Y0, Y1, Y2, Y3, Y4, Y5, Y6, 33)
+	ROUND(Y6, Y7, Y0, Y1, Y2, Y3, Y4, Y5, 34)
+	ROUND(Y5, Y6, Y7, Y0, Y1, Y2, Y3, Y4, 35)
+	ROUND(Y4, Y5, Y6, Y7, Y0, Y1, Y2, Y3, 36)
+	ROUND(Y3, Y4, Y5, Y6, Y7, Y0, Y1, Y2, 37)
+	ROUND(Y2, Y3, Y4, Y5, Y6, Y7, Y0, Y1, 38)
+	ROUND(Y1, Y2, Y3, Y4, Y5, Y6, Y7, Y0, 39)
+	ROUND(Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7, 40)
+	ROUND(Y7, Y0, Y1, Y2, Y3, Y4, Y5, Y6, 41)
+	ROUND(Y6, Y7, Y0, Y1, Y2, Y3, Y4, Y5, 42)
+	ROUND(Y5, Y6, Y7, Y0, Y1, Y2, Y3, Y4, 43)
+	ROUND(Y4, Y5, Y6, Y7, Y0, Y1, Y2, Y3, 44)
+	ROUND(Y3, Y4, Y5, Y6, Y7, Y0, Y1, Y2, 45)
+	ROUND(Y2, Y3, Y4, Y5, Y6, Y7, Y0, Y1, 46)
+	ROUND(Y1, Y2, Y3, Y4, Y5, Y6, Y7, Y0, 47)
+	ROUND(Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7, 48)
+	ROUND(Y7, Y0, Y1, Y2, Y3, Y4, Y5, Y6, 49)
+	ROUND(Y6, Y7, Y0, Y1, Y2, Y3, Y4, Y5, 50)
+	ROUND(Y5, Y6, Y7, Y0, Y1, Y2, Y3, Y4, 51)
+	ROUND(Y4, Y5, Y6, Y7, Y0, Y1, Y2, Y3, 52)
+	ROUND(Y3, Y4, Y5, Y6, Y7, Y0, Y1, Y2, 53)
+	ROUND(Y2, Y3, Y4, Y5, Y6, Y7, Y0, Y1, 54)
+	ROUND(Y1, Y2, Y3, Y4, Y5, Y6, Y7, Y0, 55)
+	ROUND(Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7, 56)
+	ROUND(Y7, Y0, Y1, Y2, Y3, Y4, Y5, Y6, 57)
+	ROUND(Y6, Y7, Y0, Y1, Y2, Y3, Y4, Y5, 58)
+	ROUND(Y5, Y6, Y7, Y0, Y1, Y2, Y3, Y4, 59)
+	ROUND(Y4, Y5, Y6, Y7, Y0, Y1, Y2, Y3, 60)
+	ROUND(Y3, Y4, Y5, Y6, Y7, Y0, Y1, Y2, 61)
+	ROUND(Y2, Y3, Y4, Y5, Y6, Y7, Y0, Y1, 62)
+	ROUND(Y1, Y2, Y3, Y4, Y5, Y6, Y7, Y0, 63)
+
+	VPADDD (0*32)(DI), Y0, Y0
+	VMOVDQU Y0, (0*32)(DI)
+	VPADDD (1*32)(DI), Y1, Y1
+	VMOVDQU Y1, (1*32)(DI)
+	VPADDD (2*32)(DI), Y2, Y2
+	VMOVDQU Y2, (2*32)(DI)
+	VPADDD (3*32)(DI), Y3, Y3
+	VMOVDQU Y3, (3*32)(DI)
+	VPADDD (4*32)(DI), Y4, Y4
+	VMOVDQU Y4, (4*32)(DI)
+	VPADDD (5*32)(DI), Y5, Y5
+	VMOVDQU Y5, (5*32)(DI)
+	VPADDD (6*32)(DI), Y6, Y6
+	VMOVDQU Y6, (6*32)(DI)
+	VPADDD (7*32)(DI), Y7, Y7
+	VMOVDQU Y7, (7*32)(DI)
+
+	VZEROUPPER
+	RET
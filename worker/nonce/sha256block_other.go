@@ -0,0 +1,14 @@
+//go:build !amd64 || purego
+// +build !amd64 purego
+
+package nonce
+
+// Only amd64 has assembly backends, so SHA-256 always goes through crypto/sha256 elsewhere
+
+func blockSHANI(h *[8]uint32, p []byte) {
+	panic("nonce: SHA-NI backend used without CPU support")
+}
+
+func block8AVX2(b *laneBlock) {
+	panic("nonce: AVX2 backend used without CPU support")
+}
@@ -0,0 +1,131 @@
+package nonce
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// genesisHeader is Bitcoin's genesis block header without its nonce, 2083236893
+const genesisHeader = "01000000" + "0000000000000000000000000000000000000000000000000000000000000000" +
+	"3ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a" + "29ab5f49" + "ffff001d"
+
+// sha256Backends runs f with each SHA-256 backend this CPU supports forced on in turn, starting with crypto/sha256
+func sha256Backends(t testing.TB, f func(t testing.TB, backend string)) {
+	shani, avx2 := useSHANI, useAVX2
+	defer func() {
+		useSHANI, useAVX2 = shani, avx2
+	}()
+
+	backends := []struct {
+		name        string
+		shani, avx2 bool
+		supported   bool
+	}{
+		{StdlibBackend, false, false, true},
+		{SHANIBackend, true, false, shani},
+		{AVX2Backend, false, true, avx2},
+	}
+	for _, b := range backends {
+		if !b.supported {
+			t.Logf("Skipping %s backend, as this CPU doesn't support it", b.name)
+			continue
+		}
+		useSHANI, useAVX2 = b.shani, b.avx2
+		f(t, b.name)
+	}
+}
+
+func referenceSHA256(data []byte, double bool) []byte {
+	sum := sha256.Sum256(data)
+	if double {
+		sum = sha256.Sum256(sum[:])
+	}
+	return sum[:]
+}
+
+// TestSHA256Backends checks every backend against crypto/sha256, with prefixes and suffixes either side of the
+// block boundaries, hashing suffixes one at a time and in batches of different lengths
+func TestSHA256Backends(t *testing.T) {
+	sha256Backends(t, func(t testing.TB, backend string) {
+		for _, double := range []bool{false, true} {
+			for _, prefixLen := range []int{0, 1, 55, 56, 63, 64, 65, 119, 128, 1000} {
+				prefix := []byte(strings.Repeat("p", prefixLen))
+				m := newSHA256Midstate(prefix, double).Clone()
+
+				var suffixes, digests [][]byte
+				for suffixLen := 0; suffixLen < 80; suffixLen += 9 {
+					suffix := []byte(strings.Repeat("s", suffixLen))
+					want := referenceSHA256(append(append([]byte(nil), prefix...), suffix...), double)
+					if got := m.Hash(nil, suffix); !bytes.Equal(got, want) {
+						t.Fatalf("%s: prefix %d, suffix %d, double %t: got %x, want %x", backend, prefixLen, suffixLen, double, got, want)
+					}
+					suffixes = append(suffixes, suffix)
+					digests = append(digests, nil)
+				}
+
+				b, ok := m.(batchMidstate)
+				if !ok {
+					continue
+				}
+				for start := 0; start < len(suffixes); start += b.batchSize() {
+					end := start + b.batchSize()
+					if end > len(suffixes) {
+						end = len(suffixes)
+					}
+					b.hashBatch(digests[start:end], suffixes[start:end])
+				}
+				for i, suffix := range suffixes {
+					want := referenceSHA256(append(append([]byte(nil), prefix...), suffix...), double)
+					if !bytes.Equal(digests[i], want) {
+						t.Fatalf("%s batch: prefix %d, suffix %d, double %t: got %x, want %x", backend, prefixLen, len(suffix), double, digests[i], want)
+					}
+				}
+			}
+		}
+	})
+}
+
+// TestSHA256BackendSearch checks that every backend enumerates the same nonces, including in header mode and with
+// variable length decimal nonces, whose batches take different numbers of blocks
+func TestSHA256BackendSearch(t *testing.T) {
+	header, err := ParseBlockHeader(genesisHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configs := []*WorkerConfig{
+		{Contents: "COMSM0010cloud", UpperBound: 1 << 16, Target: TargetFromLeadingZeros(8)},
+		{Contents: strings.Repeat("x", 51) + "{nonce}", Encoding: Encoding{Decimal, 0}, LowerBound: 9990, UpperBound: 1 << 16, Target: TargetFromLeadingZeros(8)},
+		{Contents: "COMSM0010cloud", UpperBound: 1 << 16, Target: TargetFromLeadingZeros(8), Hasher: sha256Hasher{}, Order: Order{Kind: Shuffled}},
+		{Header: header, LowerBound: 2083236000, UpperBound: 2083237000},
+	}
+
+	for i, config := range configs {
+		var want string
+		sha256Backends(t, func(t testing.TB, backend string) {
+			e, err := EnumerateGoldenNonces(context.Background(), config, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := fmt.Sprint(e.Nonces)
+			if want == "" {
+				want = got
+			} else if got != want {
+				t.Fatalf("config %d: %s found %s, crypto/sha256 found %s", i, backend, got, want)
+			}
+		})
+		if want == "[]" {
+			t.Fatalf("config %d: no golden nonces to compare", i)
+		}
+	}
+}
+
+// BenchmarkSHA256Backends measures the search loop with each backend
+func BenchmarkSHA256Backends(b *testing.B) {
+	sha256Backends(b, func(t testing.TB, backend string) {
+		b.Run(backend, BenchmarkSearch)
+	})
+}
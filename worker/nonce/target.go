@@ -0,0 +1,142 @@
+package nonce
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// Target is a 256-bit big-endian number which a golden hash must not exceed
+type Target [32]byte
+
+// TargetFromLeadingZeros gives the target met by any hash with at least the given number of leading zero bits
+func TargetFromLeadingZeros(zeros int) Target {
+	var t Target
+	for i := range t {
+		bit := i * 8
+		switch {
+		case zeros >= bit+8:
+			t[i] = 0
+		case zeros <= bit:
+			t[i] = 0xff
+		default:
+			t[i] = 0xff >> uint(zeros-bit)
+		}
+	}
+	return t
+}
+
+// TargetFromCompact expands Bitcoin's compact nBits representation, a base 256 exponent and a 23-bit mantissa.
+// Negative and overflowing values can't be met by any hash, so give a zero target.
+func TargetFromCompact(bits uint32) Target {
+	var t Target
+	exponent := int(bits >> 24)
+	mantissa := bits & 0x007fffff
+	if bits&0x00800000 != 0 || mantissa == 0 {
+		return t
+	}
+
+	// The mantissa is the most significant bytes of a number exponent bytes long
+	for i := 0; i < 3; i++ {
+		pos := 32 - exponent + i
+		b := byte(mantissa >> uint(8*(2-i)))
+		if pos < 0 {
+			if b != 0 {
+				return Target{}
+			}
+			continue
+		}
+		if pos < 32 {
+			t[pos] = b
+		}
+	}
+	return t
+}
+
+// ParseTarget reads a target given either as 64 hex digits, or as compact nBits of at most 8 hex digits
+func ParseTarget(s string) (Target, error) {
+	var t Target
+	if len(s) <= 8 {
+		bits, err := strconv.ParseUint(s, 16, 32)
+		if err != nil {
+			return t, fmt.Errorf("Invalid compact target %q, must be hex", s)
+		}
+		return TargetFromCompact(uint32(bits)), nil
+	}
+
+	data, err := hex.DecodeString(s)
+	if err != nil || len(data) != len(t) {
+		return t, fmt.Errorf("Invalid target %q, must be 64 hex digits or compact nBits", s)
+	}
+	copy(t[:], data)
+	return t, nil
+}
+
+// String hex encodes the full target, in the form accepted by ParseTarget
+func (t Target) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// MarshalText encodes the target as 64 hex digits, so it reads naturally in JSON
+func (t Target) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText reads a target in any form accepted by ParseTarget
+func (t *Target) UnmarshalText(text []byte) error {
+	parsed, err := ParseTarget(string(text))
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// Met reports whether hash, read as a big-endian number, is at most the target
+func (t Target) Met(hash []byte) bool {
+	return bytes.Compare(hash, t[:]) <= 0
+}
+
+// IsZero reports whether the target is zero, which almost no hash can meet
+func (t Target) IsZero() bool {
+	return t == Target{}
+}
+
+// LeadingZeros counts the leading zero bits of the target, a rough measure of its difficulty
+func (t Target) LeadingZeros() int {
+	return leadingZeros(t[:])
+}
+
+// Probability is the chance of a uniformly random hash meeting the target, (target + 1) / 2^256
+func (t Target) Probability() float64 {
+	n := new(big.Int).SetBytes(t[:])
+	n.Add(n, big.NewInt(1))
+	p, _ := new(big.Float).SetMantExp(new(big.Float).SetInt(n), -256).Float64()
+	return p
+}
+
+// Compact encodes the target in Bitcoin's nBits form, losing all but its 3 most significant bytes
+func (t Target) Compact() uint32 {
+	start := 0
+	for start < len(t) && t[start] == 0 {
+		start++
+	}
+	if start == len(t) {
+		return 0
+	}
+
+	var mantissa [4]byte
+	copy(mantissa[1:], t[start:])
+	size := uint32(len(t) - start)
+	m := binary.BigEndian.Uint32(mantissa[:])
+
+	// The top mantissa bit is a sign, so shift it out of the way
+	if m&0x00800000 != 0 {
+		m >>= 8
+		size++
+	}
+	return size<<24 | m
+}
@@ -0,0 +1,95 @@
+package nonce
+
+import (
+	"strings"
+	"testing"
+)
+
+// hexTarget pads the significant hex digits of a target, given from its most significant byte, out to 64
+func hexTarget(leadingZeroBytes int, digits string) string {
+	s := strings.Repeat("00", leadingZeroBytes) + digits
+	return s + strings.Repeat("0", 64-len(s))
+}
+
+func TestTargetFromCompact(t *testing.T) {
+	tests := []struct {
+		name   string
+		bits   uint32
+		target string
+	}{
+		{"genesis", 0x1d00ffff, hexTarget(4, "ffff")},
+		{"block 100000", 0x1b0404cb, hexTarget(5, "0404cb")},
+		{"regtest", 0x207fffff, hexTarget(0, "7fffff")},
+		{"exponent 0", 0x00123456, hexTarget(32, "")},
+		{"exponent 1", 0x01123456, hexTarget(31, "12")},
+		{"exponent 2", 0x02123456, hexTarget(30, "1234")},
+		{"exponent 3", 0x03123456, hexTarget(29, "123456")},
+		{"exponent 4", 0x04123456, hexTarget(28, "12345600")},
+		{"exponent 34", 0x22000001, hexTarget(0, "01")},
+		{"zero mantissa", 0x1d000000, hexTarget(32, "")},
+		{"sign bit", 0x04923456, hexTarget(32, "")},
+		{"sign bit, small exponent", 0x01fedcba, hexTarget(32, "")},
+		{"overflow", 0x23000001, hexTarget(32, "")},
+		{"overflow past 32 bytes", 0x21010000, hexTarget(32, "")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := TargetFromCompact(test.bits).String(); got != test.target {
+				t.Errorf("TargetFromCompact(%08x) = %s, want %s", test.bits, got, test.target)
+			}
+		})
+	}
+}
+
+func TestCompactRoundTrip(t *testing.T) {
+	for _, bits := range []uint32{0x1d00ffff, 0x1b0404cb, 0x207fffff, 0x1715a35c, 0x01120000, 0x02008000, 0x03123456, 0x04123456} {
+		target := TargetFromCompact(bits)
+		if got := target.Compact(); got != bits {
+			t.Errorf("TargetFromCompact(%08x).Compact() = %08x", bits, got)
+		}
+
+		parsed, err := ParseTarget(target.String())
+		if err != nil || parsed != target {
+			t.Errorf("ParseTarget(%s) = %s, %v", target, parsed, err)
+		}
+	}
+
+	if got := (Target{}).Compact(); got != 0 {
+		t.Errorf("Compact of the zero target = %08x, want 0", got)
+	}
+	// Compact keeps only the 3 most significant bytes, moving the sign bit out of the mantissa
+	if got := TargetFromLeadingZeros(32).Compact(); got != 0x1d00ffff {
+		t.Errorf("Compact of 32 leading zeros = %08x, want 1d00ffff", got)
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		input  string
+		target string
+		valid  bool
+	}{
+		{"1d00ffff", hexTarget(4, "ffff"), true},
+		{"207fffff", hexTarget(0, "7fffff"), true},
+		{"ffff", hexTarget(32, ""), true},
+		{hexTarget(2, "0fff"), hexTarget(2, "0fff"), true},
+		{strings.ToUpper(hexTarget(4, "ffff")), hexTarget(4, "ffff"), true},
+		{"", "", false},
+		{"1d00fffz", "", false},
+		{"1d00ffff0", "", false},
+		{hexTarget(0, "")[1:], "", false},
+		{hexTarget(0, "") + "00", "", false},
+	}
+	for _, test := range tests {
+		target, err := ParseTarget(test.input)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("ParseTarget(%q) = %s, want an error", test.input, target)
+			}
+			continue
+		}
+		if err != nil || target.String() != test.target {
+			t.Errorf("ParseTarget(%q) = %s, %v, want %s", test.input, target, err, test.target)
+		}
+	}
+}
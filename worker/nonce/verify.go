@@ -0,0 +1,31 @@
+package nonce
+
+import "encoding/hex"
+
+// Verify recomputes the double SHA-256 hash of contents with nonce appended, returning it along with whether it
+// meets target
+func Verify(contents string, nonce uint32, target Target) (string, bool) {
+	return VerifyConfig(&WorkerConfig{Contents: contents, Target: target}, nonce)
+}
+
+// VerifyConfig behaves like Verify, but also takes the hasher, extra nonce and header mode from config,
+// so it checks exactly what CalculateGoldenNonce would have searched. An invalid encoding, or an extra nonce which
+// can't be rolled into the header, gives no hash.
+func VerifyConfig(config *WorkerConfig, nonce uint32) (string, bool) {
+	state, err := newSearchState(config, nil)
+	if err != nil {
+		return "", false
+	}
+	hash := newCandidate(state).hash(nonce)
+	return hex.EncodeToString(hash), state.target.Met(hash)
+}
+
+// Payload returns exactly what is hashed for nonce under config, such as a hashcash stamp minted from a template,
+// or nil if the encoding is invalid or the extra nonce can't be rolled into the header
+func Payload(config *WorkerConfig, nonce uint32) []byte {
+	state, err := newSearchState(config, nil)
+	if err != nil {
+		return nil
+	}
+	return append(state.encoding.Append(state.prefix, nonce), state.suffix...)
+}
@@ -0,0 +1,74 @@
+package nonce
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+const verifyContents = "COMSM0010cloud"
+
+func TestVerify(t *testing.T) {
+	target := TargetFromLeadingZeros(12)
+	gn, err := CalculateGoldenNonce(&WorkerConfig{Contents: verifyContents, UpperBound: NonceSpace, Target: target, Threads: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The hash is the double SHA-256 of the contents with the nonce appended big-endian
+	payload := append([]byte(verifyContents), 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(payload[len(verifyContents):], gn.Nonce)
+	first := sha256.Sum256(payload)
+	want := sha256.Sum256(first[:])
+
+	hash, ok := Verify(verifyContents, gn.Nonce, target)
+	if !ok || hash != gn.Hash || hash != hex.EncodeToString(want[:]) {
+		t.Errorf("Verify(%d) = %s, %t, want %x, true", gn.Nonce, hash, ok, want)
+	}
+
+	for _, tampered := range []uint32{gn.Nonce + 1, gn.Nonce ^ 0x80000000} {
+		if hash, ok := Verify(verifyContents, tampered, target); ok || hash == gn.Hash {
+			t.Errorf("Verify(%d), tampered from %d, = %s, %t, want another hash which isn't golden", tampered, gn.Nonce, hash, ok)
+		}
+	}
+	if _, ok := Verify(verifyContents+"!", gn.Nonce, target); ok {
+		t.Errorf("Verify(%d) of tampered contents is golden", gn.Nonce)
+	}
+}
+
+func TestVerifyConfig(t *testing.T) {
+	hasher, _ := NewHasher(SHA3256, "")
+	encoding, _ := ParseEncoding("dec")
+	config := &WorkerConfig{
+		Contents:   "block {nonce} end",
+		UpperBound: NonceSpace,
+		Target:     TargetFromLeadingZeros(10),
+		ExtraNonce: 5,
+		Encoding:   encoding,
+		Hasher:     hasher,
+		Threads:    1,
+	}
+	gn, err := CalculateGoldenNonce(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash, ok := VerifyConfig(config, gn.Nonce); !ok || hash != gn.Hash {
+		t.Errorf("VerifyConfig(%d) = %s, %t, want %s, true", gn.Nonce, hash, ok, gn.Hash)
+	}
+
+	// Each part of the configuration changes what is hashed
+	tampered := map[string]*WorkerConfig{}
+	for _, name := range []string{"extra nonce", "encoding", "hasher"} {
+		c := *config
+		tampered[name] = &c
+	}
+	tampered["extra nonce"].ExtraNonce = 6
+	tampered["encoding"].Encoding = DefaultEncoding
+	tampered["hasher"].Hasher = nil
+	for name, c := range tampered {
+		if hash, ok := VerifyConfig(c, gn.Nonce); ok || hash == gn.Hash {
+			t.Errorf("VerifyConfig(%d) with another %s = %s, %t, want another hash which isn't golden", gn.Nonce, name, hash, ok)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Package powhttp protects HTTP handlers with proof-of-work, making clients search for a golden nonce before each
+// request is served
+package powhttp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jaylees14/pow/worker/nonce"
+)
+
+// Headers carrying a challenge to the client, and its solution back to the server
+const (
+	ChallengeHeader = "X-Pow-Challenge"
+	SolutionHeader  = "X-Pow-Solution"
+)
+
+// MaxChallengeBits is the most bits a challenge can ask for, keeping it solvable within the 32-bit nonce space
+const MaxChallengeBits = 32
+
+// Challenge is a proof-of-work puzzle issued to one client. Its signed token is the block the nonce is appended
+// to, so none of its fields can be changed without invalidating the solution.
+type Challenge struct {
+	// Prefix is random, so that solutions can't be computed in advance
+	Prefix string `json:"prefix"`
+	// Bits is the number of leading zero bits the double SHA-256 hash must have
+	Bits int `json:"bits"`
+	// Expires is the unix time after which solutions are no longer accepted
+	Expires int64 `json:"expires"`
+	// Client is the address the challenge was issued to
+	Client string `json:"client"`
+	// token is the signed form the challenge was parsed from
+	token string
+}
+
+// Token returns the signed form of the challenge, as sent in ChallengeHeader
+func (c *Challenge) Token() string {
+	return c.token
+}
+
+// Config returns the nonce search which solves the challenge
+func (c *Challenge) Config() *nonce.WorkerConfig {
+	return &nonce.WorkerConfig{
+		Contents:   c.token,
+		UpperBound: nonce.NonceSpace,
+		Target:     nonce.TargetFromLeadingZeros(c.Bits),
+	}
+}
+
+// signChallenge fills in c's token, the base64 JSON of its fields and their HMAC-SHA256 under key
+func signChallenge(c *Challenge, key []byte) error {
+	body, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(body)
+	c.token = payload + "." + base64.RawURLEncoding.EncodeToString(mac(key, payload))
+	return nil
+}
+
+func mac(key []byte, payload string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+// ParseChallenge reads a challenge from its token, without checking the signature, as clients have to
+func ParseChallenge(token string) (*Challenge, error) {
+	dot := strings.IndexByte(token, '.')
+	if dot < 0 {
+		return nil, errors.New("Invalid challenge, must be payload.signature")
+	}
+	body, err := base64.RawURLEncoding.DecodeString(token[:dot])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid challenge payload: %s", err)
+	}
+
+	c := &Challenge{token: token}
+	if err := json.Unmarshal(body, c); err != nil {
+		return nil, fmt.Errorf("Invalid challenge payload: %s", err)
+	} else if c.Bits <= 0 || c.Bits > MaxChallengeBits {
+		return nil, fmt.Errorf("Invalid challenge bits, must be in range (0, %d]", MaxChallengeBits)
+	}
+	return c, nil
+}
+
+// verifyChallenge parses a token, checking that it was signed with key
+func verifyChallenge(token string, key []byte) (*Challenge, error) {
+	c, err := ParseChallenge(token)
+	if err != nil {
+		return nil, err
+	}
+	dot := strings.IndexByte(token, '.')
+	signature, err := base64.RawURLEncoding.DecodeString(token[dot+1:])
+	if err != nil || !hmac.Equal(signature, mac(key, token[:dot])) {
+		return nil, errors.New("Invalid challenge signature")
+	}
+	return c, nil
+}
+
+// Solution is a nonce found for a challenge
+type Solution struct {
+	Challenge *Challenge
+	Nonce     uint32
+}
+
+// String formats the solution as sent in SolutionHeader, the challenge token followed by ':' and the nonce
+func (s *Solution) String() string {
+	return s.Challenge.token + ":" + strconv.FormatUint(uint64(s.Nonce), 10)
+}
+
+// parseSolution reads a solution from SolutionHeader, checking the challenge was signed with key
+func parseSolution(header string, key []byte) (*Solution, error) {
+	colon := strings.LastIndexByte(header, ':')
+	if colon < 0 {
+		return nil, errors.New("Invalid solution, must be challenge:nonce")
+	}
+	n, err := strconv.ParseUint(header[colon+1:], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid solution nonce %s", header[colon+1:])
+	}
+	c, err := verifyChallenge(header[:colon], key)
+	if err != nil {
+		return nil, err
+	}
+	return &Solution{Challenge: c, Nonce: uint32(n)}, nil
+}
+
+// Verify checks that the solution's nonce meets its challenge's target
+func (s *Solution) Verify() bool {
+	_, ok := nonce.VerifyConfig(s.Challenge.Config(), s.Nonce)
+	return ok
+}
@@ -0,0 +1,69 @@
+package powhttp
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/jaylees14/pow/worker/nonce"
+)
+
+// Solve searches for a nonce meeting the challenge in token, using every CPU of this machine
+func Solve(ctx context.Context, token string) (*Solution, error) {
+	c, err := ParseChallenge(token)
+	if err != nil {
+		return nil, err
+	}
+
+	gn, err := nonce.CalculateGoldenNonceContext(ctx, c.Config())
+	if err != nil {
+		return nil, err
+	}
+	return &Solution{Challenge: c, Nonce: gn.Nonce}, nil
+}
+
+// Transport is an http.RoundTripper which, when a Guard answers with a challenge, solves it and sends the request
+// again with the solution
+type Transport struct {
+	// Base makes the requests, defaulting to http.DefaultTransport
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper. Requests with a body are only retried if it can be read again
+// through GetBody, as http.NewRequest arranges for common body types.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		return resp, err
+	}
+	token := resp.Header.Get(ChallengeHeader)
+	if len(token) == 0 || (req.Body != nil && req.GetBody == nil) {
+		return resp, nil
+	}
+
+	solution, err := Solve(req.Context(), token)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+	retry.Header.Set(SolutionHeader, solution.String())
+
+	// Drain the challenge response so its connection can be reused
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return base.RoundTrip(retry)
+}
@@ -0,0 +1,244 @@
+package powhttp
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"math/bits"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jaylees14/pow/worker/hashcash"
+)
+
+// Defaults used for any Guard field left as zero
+const (
+	DefaultBits         = 16
+	DefaultMaxBits      = 24
+	DefaultFreeRequests = 10
+	DefaultWindow       = time.Minute
+	DefaultTTL          = time.Minute
+)
+
+// prefixBytes is the amount of randomness in each challenge
+const prefixBytes = 12
+
+// errNoKey is returned by a Guard without a Key, whose challenges anyone could sign
+var errNoKey = errors.New("Guard has no key to sign challenges with")
+
+// Guard is middleware which only passes on requests carrying a solved challenge, answering others with
+// 429 Too Many Requests and a fresh challenge in ChallengeHeader
+type Guard struct {
+	// Key signs challenges, so that clients can't choose their own. It must not be empty.
+	Key []byte
+	// Bits is the difficulty of challenges issued to clients making no more than FreeRequests per Window
+	Bits int
+	// MaxBits caps the difficulty, which rises by a bit, doubling the work, each time a client's rate doubles. It is
+	// itself capped at MaxChallengeBits, as clients can't solve harder challenges.
+	MaxBits      int
+	FreeRequests int
+	Window       time.Duration
+	// TTL is how long a client has to solve a challenge and make its request
+	TTL time.Duration
+	// Store records solved challenges, so that each admits a single request. Defaults to a hashcash.MemoryStore.
+	Store hashcash.SeenStore
+	// ClientIP identifies the client, defaulting to the host of the request's RemoteAddr
+	ClientIP func(*http.Request) string
+	// Now returns the current time, defaulting to time.Now
+	Now func() time.Time
+
+	once  sync.Once
+	store hashcash.SeenStore
+	rates *rateTracker
+}
+
+// Wrap returns a handler which calls next only for requests with a valid solution. It panics if the guard has no
+// Key, as every request would then be let through by a forged solution.
+func (g *Guard) Wrap(next http.Handler) http.Handler {
+	if len(g.Key) == 0 {
+		panic(errNoKey)
+	}
+	g.once.Do(g.init)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := g.clientIP(r)
+
+		var err error
+		if solution := r.Header.Get(SolutionHeader); len(solution) > 0 {
+			if err = g.verify(solution, client); err == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		token, challengeErr := g.Issue(client)
+		if challengeErr != nil {
+			http.Error(w, "Couldn't issue challenge", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(ChallengeHeader, token)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+		} else {
+			http.Error(w, "Proof of work required", http.StatusTooManyRequests)
+		}
+	})
+}
+
+func (g *Guard) init() {
+	g.store = g.Store
+	if g.store == nil {
+		g.store = hashcash.NewMemoryStore()
+	}
+	g.rates = newRateTracker()
+}
+
+func (g *Guard) now() time.Time {
+	if g.Now != nil {
+		return g.Now()
+	}
+	return time.Now()
+}
+
+func (g *Guard) clientIP(r *http.Request) string {
+	if g.ClientIP != nil {
+		return g.ClientIP(r)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Issue returns the token of a new challenge for client, whose difficulty depends on how many it has been issued
+// in the current window
+func (g *Guard) Issue(client string) (string, error) {
+	if len(g.Key) == 0 {
+		return "", errNoKey
+	}
+	g.once.Do(g.init)
+
+	random := make([]byte, prefixBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	ttl := g.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	now := g.now()
+
+	c := &Challenge{
+		Prefix:  base64.RawURLEncoding.EncodeToString(random),
+		Bits:    g.difficulty(g.rates.hit(client, now, g.window())),
+		Expires: now.Add(ttl).Unix(),
+		Client:  client,
+	}
+	if err := signChallenge(c, g.Key); err != nil {
+		return "", err
+	}
+	return c.token, nil
+}
+
+func (g *Guard) window() time.Duration {
+	if g.Window == 0 {
+		return DefaultWindow
+	}
+	return g.Window
+}
+
+// difficulty returns the bits for a client which has already made count requests in the window
+func (g *Guard) difficulty(count int) int {
+	base, max, free := g.Bits, g.MaxBits, g.FreeRequests
+	if base == 0 {
+		base = DefaultBits
+	}
+	if max == 0 {
+		max = DefaultMaxBits
+	} else if max > MaxChallengeBits {
+		max = MaxChallengeBits
+	}
+	if free == 0 {
+		free = DefaultFreeRequests
+	}
+
+	d := base + bits.Len(uint(count/free))
+	if d > max {
+		return max
+	}
+	return d
+}
+
+// verify checks a solution sent by client, marking its challenge as spent
+func (g *Guard) verify(header string, client string) error {
+	if len(g.Key) == 0 {
+		return errNoKey
+	}
+	solution, err := parseSolution(header, g.Key)
+	if err != nil {
+		return err
+	}
+
+	c := solution.Challenge
+	expiry := time.Unix(c.Expires, 0)
+	if c.Client != client {
+		return errors.New("Invalid solution, challenge was issued to another client")
+	} else if g.now().After(expiry) {
+		return errors.New("Invalid solution, challenge has expired")
+	} else if !solution.Verify() {
+		return errors.New("Invalid solution, hash doesn't meet the target")
+	}
+
+	fresh, err := g.store.Add(c.token, expiry)
+	if err != nil {
+		return err
+	} else if !fresh {
+		return errors.New("Invalid solution, challenge has already been used")
+	}
+	return nil
+}
+
+// rateTracker counts the challenges issued to each client in fixed windows
+type rateTracker struct {
+	mu      sync.Mutex
+	windows map[string]*rateWindow
+	hits    int
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newRateTracker() *rateTracker {
+	return &rateTracker{windows: make(map[string]*rateWindow)}
+}
+
+// hit records a request by client, returning how many it had already made in the current window
+func (t *rateTracker) hit(client string, now time.Time, window time.Duration) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.hits++
+	if t.hits%pruneInterval == 0 {
+		for c, w := range t.windows {
+			if now.Sub(w.start) >= window {
+				delete(t.windows, c)
+			}
+		}
+	}
+
+	w, ok := t.windows[client]
+	if !ok || now.Sub(w.start) >= window {
+		w = &rateWindow{start: now}
+		t.windows[client] = w
+	}
+	w.count++
+	return w.count - 1
+}
+
+// pruneInterval is how many requests are tracked between removals of finished windows
+const pruneInterval = 1024
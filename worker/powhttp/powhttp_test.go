@@ -0,0 +1,204 @@
+package powhttp
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBits = 8
+
+// okHandler answers every request it is passed with "ok"
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "ok")
+})
+
+// recordingTransport remembers the last solution sent through it
+type recordingTransport struct {
+	solution string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if s := req.Header.Get(SolutionHeader); len(s) > 0 {
+		t.solution = s
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// serve passes handler a request carrying solution, if it isn't empty
+func serve(handler http.Handler, solution string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if len(solution) > 0 {
+		req.Header.Set(SolutionHeader, solution)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+// solve solves a challenge token, failing the test if it can't
+func solve(t *testing.T, token string) string {
+	t.Helper()
+	solution, err := Solve(context.Background(), token)
+	if err != nil {
+		t.Fatalf("Solve(%s): %v", token, err)
+	}
+	return solution.String()
+}
+
+func TestRoundTrip(t *testing.T) {
+	guard := &Guard{Key: []byte("secret"), Bits: testBits}
+	server := httptest.NewServer(guard.Wrap(okHandler))
+	defer server.Close()
+
+	recorder := &recordingTransport{}
+	client := &http.Client{Transport: &Transport{Base: recorder}}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+			t.Fatalf("Request %d = %d %q, want 200 ok", i, resp.StatusCode, body)
+		}
+	}
+
+	// Sending the last solution again is rejected
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set(SolutionHeader, recorder.solution)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || !strings.Contains(string(body), "already been used") {
+		t.Errorf("Replayed solution = %d %q, want 429 already been used", resp.StatusCode, body)
+	}
+	if len(resp.Header.Get(ChallengeHeader)) == 0 {
+		t.Error("Rejected request wasn't sent a fresh challenge")
+	}
+}
+
+func TestGuardRejects(t *testing.T) {
+	// The store expires spent challenges by the real clock, so the guard's only runs ahead of it
+	now := time.Now()
+	guard := &Guard{Key: []byte("secret"), Bits: testBits, TTL: time.Minute, Now: func() time.Time { return now }}
+	handler := guard.Wrap(okHandler)
+
+	// httptest requests come from 192.0.2.1
+	issue := func(client string) string {
+		token, err := guard.Issue(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid := solve(t, issue("192.0.2.1"))
+	expired := solve(t, issue("192.0.2.1"))
+	otherClient := solve(t, issue("198.51.100.7"))
+	forged := solve(t, func() string {
+		other := &Guard{Key: []byte("other"), Bits: testBits}
+		token, _ := other.Issue("192.0.2.1")
+		return token
+	}())
+
+	// Find a nonce which doesn't meet the target, by looking past the golden one
+	c, _ := ParseChallenge(issue("192.0.2.1"))
+	unsolved := &Solution{Challenge: c}
+	for unsolved.Verify() {
+		unsolved.Nonce++
+	}
+
+	tests := []struct {
+		name     string
+		solution string
+		advance  time.Duration
+		status   int
+		err      string
+	}{
+		{"no solution", "", 0, http.StatusTooManyRequests, "Proof of work required"},
+		{"valid", valid, 0, http.StatusOK, "ok"},
+		{"replayed", valid, 0, http.StatusTooManyRequests, "already been used"},
+		{"other client", otherClient, 0, http.StatusTooManyRequests, "another client"},
+		{"forged", forged, 0, http.StatusTooManyRequests, "signature"},
+		{"unsolved", unsolved.String(), 0, http.StatusTooManyRequests, "doesn't meet the target"},
+		{"malformed", "nonsense", 0, http.StatusTooManyRequests, "challenge:nonce"},
+		{"expired", expired, 2 * time.Minute, http.StatusTooManyRequests, "expired"},
+	}
+	for _, test := range tests {
+		now = now.Add(test.advance)
+		w := serve(handler, test.solution)
+		if w.Code != test.status || !strings.Contains(w.Body.String(), test.err) {
+			t.Errorf("%s: got %d %q, want %d containing %q", test.name, w.Code, w.Body.String(), test.status, test.err)
+		}
+	}
+}
+
+func TestDifficulty(t *testing.T) {
+	tests := []struct {
+		guard *Guard
+		count int
+		bits  int
+	}{
+		{&Guard{}, 0, DefaultBits},
+		{&Guard{}, DefaultFreeRequests - 1, DefaultBits},
+		{&Guard{}, DefaultFreeRequests, DefaultBits + 1},
+		{&Guard{}, 4 * DefaultFreeRequests, DefaultBits + 3},
+		{&Guard{}, 1 << 20, DefaultMaxBits},
+		{&Guard{Bits: 4, MaxBits: 6, FreeRequests: 1}, 2, 6},
+		{&Guard{Bits: 30, MaxBits: 40, FreeRequests: 1}, 1 << 20, MaxChallengeBits},
+		{&Guard{Bits: 40, MaxBits: 40}, 0, MaxChallengeBits},
+	}
+	for _, test := range tests {
+		if got := test.guard.difficulty(test.count); got != test.bits {
+			g := test.guard
+			t.Errorf("difficulty(%d) with bits %d, max %d = %d, want %d", test.count, g.Bits, g.MaxBits, got, test.bits)
+		}
+	}
+}
+
+func TestIssueWithLargeMaxBits(t *testing.T) {
+	guard := &Guard{Key: []byte("secret"), Bits: 40, MaxBits: 64}
+	token, err := guard.Issue("192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err := ParseChallenge(token); err != nil || c.Bits != MaxChallengeBits {
+		t.Errorf("ParseChallenge of an issued challenge = %v, %v, want %d bits", c, err, MaxChallengeBits)
+	}
+}
+
+func TestGuardWithoutKey(t *testing.T) {
+	for _, key := range [][]byte{nil, {}} {
+		guard := &Guard{Key: key, Bits: testBits}
+		if _, err := guard.Issue("192.0.2.1"); err == nil {
+			t.Errorf("Issue with key %q succeeded, want an error", key)
+		}
+
+		// A challenge signed with an empty key, as a client could forge, is rejected
+		forged := &Challenge{Prefix: "forged", Bits: testBits, Expires: time.Now().Add(time.Minute).Unix(), Client: "192.0.2.1"}
+		if err := signChallenge(forged, key); err != nil {
+			t.Fatal(err)
+		}
+		if err := guard.verify(solve(t, forged.token), "192.0.2.1"); err == nil {
+			t.Errorf("verify with key %q accepted a forged solution", key)
+		}
+
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Wrap with key %q didn't panic", key)
+				}
+			}()
+			guard.Wrap(okHandler)
+		}()
+	}
+}